@@ -189,7 +189,7 @@ func build() error {
 				continue
 			}
 			targets = append(targets, cut)
-		} else {
+		} else if !strings.HasSuffix(name, "_test.go") {
 			source = append(source, filepath.Join(srcDir, name))
 		}
 	}
@@ -3,6 +3,7 @@ package main
 import (
 	"bytes"
 	"errors"
+	"fmt"
 	"os"
 	"os/exec"
 	"text/template"
@@ -50,11 +51,19 @@ func BuildFromApp(a Args) error {
 	}
 	found := false
 	var rules build
-	for k, v := range cfg.Settings.Builds {
-		if PathExists(k) {
-			rules = v
-			found = true
-			break
+	if len(os.Args) > 1 {
+		recipe := os.Args[1]
+		rules, found = cfg.Settings.Builds[recipe]
+		if !found {
+			return fmt.Errorf("unknown build recipe: %s", recipe)
+		}
+	} else {
+		for k, v := range cfg.Settings.Builds {
+			if PathExists(k) {
+				rules = v
+				found = true
+				break
+			}
 		}
 	}
 	if !found {
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"os"
 	"os/exec"
+	"slices"
 )
 
 func updateByTool(tool string, args, remotes []string) error {
@@ -33,9 +34,38 @@ func DevtoolsApp(a Args) error {
 		return err
 	}
 
+	only := os.Args[1:]
+	var unknown []string
+	for _, p := range only {
+		configured := false
+		for _, v := range cfg.Settings {
+			if slices.Contains(v.Packages, p) {
+				configured = true
+				break
+			}
+		}
+		if !configured {
+			unknown = append(unknown, p)
+		}
+	}
+	if len(unknown) > 0 {
+		return fmt.Errorf("unknown packages: %v", unknown)
+	}
 	for k, v := range cfg.Settings {
+		packages := v.Packages
+		if len(only) > 0 {
+			packages = nil
+			for _, p := range v.Packages {
+				if slices.Contains(only, p) {
+					packages = append(packages, p)
+				}
+			}
+			if len(packages) == 0 {
+				continue
+			}
+		}
 		fmt.Printf("%s updates:\n", k)
-		if err := updateByTool(k, v.Arguments, v.Packages); err != nil {
+		if err := updateByTool(k, v.Arguments, packages); err != nil {
 			return err
 		}
 	}
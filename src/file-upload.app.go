@@ -2,24 +2,54 @@
 package main
 
 import (
+	"bufio"
+	"crypto/hmac"
+	"crypto/rand"
 	"crypto/sha256"
+	"crypto/subtle"
 	_ "embed"
+	"encoding/base64"
+	"encoding/binary"
 	"encoding/hex"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"html/template"
 	"io"
+	"net"
 	"net/http"
 	"os"
 	"path/filepath"
+	"slices"
+	"strconv"
 	"strings"
+	"sync"
+	"syscall"
 	"time"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
 )
 
 const (
-	downloadValue = "{DOWNLOAD}"
-	isUpload      = "/store"
-	isUploadTo    = isUpload + "to"
-	indexHTML     = `<!doctype html>
+	downloadValue    = "{DOWNLOAD}"
+	isUpload         = "/store"
+	isUploadTo       = isUpload + "to"
+	isResumable      = "/resumable/"
+	tusVersion       = "1.0.0"
+	tusOctets        = "application/offset+octet-stream"
+	uploadExpiry     = 24 * time.Hour
+	uploadStall      = time.Minute
+	uploadUploads    = ".cache/file-upload"
+	uploadPermission = "upload"
+	browsePermission = "browse"
+	uploadCookie     = "file-upload-session"
+	uploadLinks      = "links.json"
+	uploadLinkExpiry = time.Hour
+	uploadFailures   = 5
+	uploadLockout    = 15 * time.Minute
+	uploadBcryptCost = 12
+	indexHTML        = `<!doctype html>
 <html lang="en">
 <head>
 <meta charset="UTF-8">
@@ -86,71 +116,928 @@ body
 <a href="/` + downloadValue + `"><div class="entry">files</div></a>
     </div>
   </div>
+<script>
+// resumable (chunked) uploads, the form posts normally without script support
+const chunkSize = 8 << 20;
+const attempts = 10;
+function pause(attempt) {
+  return new Promise((resolve) => setTimeout(resolve, 1000 * (attempt + 1)));
+}
+// requests are retried (with backoff) on errors and while the upload is locked by a stalled request
+async function send(method, url, headers, body) {
+  for (let attempt = 0; ; attempt++) {
+    try {
+      const resp = await fetch(url, {method: method, headers: Object.assign({"Tus-Resumable": "` + tusVersion + `"}, headers), body: body});
+      if (resp.status < 500 && resp.status !== 423) {
+        return resp;
+      }
+    } catch (e) {
+    }
+    if (attempt >= attempts) {
+      throw new Error(method + " failed");
+    }
+    await pause(attempt);
+  }
+}
+async function offsetOf(url) {
+  const resp = await send("HEAD", url, {});
+  return resp.ok ? parseInt(resp.headers.get("Upload-Offset"), 10) : -1;
+}
+async function upload(file, status) {
+  const key = "upload:" + file.name + ":" + file.size + ":" + file.lastModified;
+  let url = localStorage.getItem(key);
+  let offset = url ? await offsetOf(url) : -1;
+  if (offset < 0) {
+    const name = btoa(unescape(encodeURIComponent(file.name)));
+    const created = await send("POST", "` + isResumable + `", {"Upload-Length": String(file.size), "Upload-Metadata": "filename " + name});
+    if (created.status !== 201) {
+      throw new Error(await created.text());
+    }
+    url = created.headers.get("Location");
+    localStorage.setItem(key, url);
+    offset = 0;
+  }
+  let conflicts = 0;
+  while (offset < file.size) {
+    const resp = await send("PATCH", url, {"Content-Type": "` + tusOctets + `", "Upload-Offset": String(offset)}, file.slice(offset, offset + chunkSize));
+    if (resp.status === 409 && conflicts < attempts) {
+      await pause(conflicts++);
+      offset = await offsetOf(url);
+      if (offset < 0) {
+        throw new Error("upload no longer available");
+      }
+      continue;
+    }
+    if (resp.status !== 204) {
+      throw new Error(await resp.text());
+    }
+    conflicts = 0;
+    offset = parseInt(resp.headers.get("Upload-Offset"), 10);
+    status.textContent = file.name + ": " + Math.floor(offset * 100 / file.size) + "%";
+  }
+  localStorage.removeItem(key);
+}
+document.getElementById("form").addEventListener("submit", async (event) => {
+  if (!window.fetch) {
+    return;
+  }
+  event.preventDefault();
+  const form = event.target;
+  const status = document.createElement("div");
+  form.appendChild(status);
+  for (const file of form.querySelector("input[type=file]").files) {
+    try {
+      await upload(file, status);
+    } catch (e) {
+      alert(file.name + ": " + e.message);
+      return;
+    }
+  }
+  window.location.href = "` + isUpload + `";
+});
+</script>
 </body>
 </html>`
 )
 
-func uploadHandler(store string, extensions []string, r *http.Request) error {
+type (
+	uploadSettings struct {
+		Bind           string
+		Store          string
+		Uploads        string
+		Extensions     []string
+		MaxFileSize    string
+		MaxRequestSize string
+		Auth           uploadAuthSettings
+	}
+	// uploadContext is the server state (limits of 0 are unlimited)
+	uploadContext struct {
+		store      string
+		uploads    string
+		extensions []string
+		maxFile    int64
+		maxRequest int64
+		mutex      sync.Mutex
+		active     map[string]bool
+		auth       *uploadAuth
+	}
+	// uploadInfo is a resumable upload in progress
+	uploadInfo struct {
+		Name    string
+		Length  int64
+		Created time.Time
+	}
+	// uploadStalled reads a request body, failing when no data arrives for a while (the connection was dropped)
+	uploadStalled struct {
+		reader     io.Reader
+		controller *http.ResponseController
+	}
+	// uploadAuthSettings enables basic auth (Passwords, htpasswd-style) and/or signed upload links (Secret),
+	// password users can upload and only Browse users can also browse/download
+	uploadAuthSettings struct {
+		Passwords   string
+		Browse      []string
+		Secret      string
+		URL         string
+		MaxFailures int
+		Lockout     string
+	}
+	uploadAuth struct {
+		passwords   string
+		browse      []string
+		secret      []byte
+		links       string
+		maxFailures int
+		lockout     time.Duration
+		mutex       sync.Mutex
+		failures    map[string][]time.Time
+		sessions    map[string]time.Time
+		verified    map[string]bool
+	}
+)
+
+var errUploadTooLarge = errors.New("upload too large")
+
+// uploadSize parses sizes with an optional (binary) unit, e.g. 512M or 4G
+func uploadSize(value string) (int64, error) {
+	if value == "" {
+		return 0, nil
+	}
+	s := strings.TrimSuffix(strings.ToUpper(strings.TrimSpace(value)), "B")
+	multiplier := int64(1)
+	for idx, unit := range []string{"K", "M", "G", "T"} {
+		if trimmed, ok := strings.CutSuffix(s, unit); ok {
+			s = trimmed
+			multiplier = 1 << (10 * (idx + 1))
+			break
+		}
+	}
+	size, err := strconv.ParseInt(s, 10, 64)
+	if err != nil || size < 0 {
+		return 0, fmt.Errorf("invalid size: %s", value)
+	}
+	return size * multiplier, nil
+}
+
+func uploadName(fileName string, extensions []string) (string, error) {
+	name := strings.ToLower(strings.TrimSpace(strings.ReplaceAll(filepath.Base(fileName), " ", "-")))
+	if name == "" || name == "." || name == ".." || name == string(filepath.Separator) {
+		return "", fmt.Errorf("invalid file name: %s", fileName)
+	}
+	for _, ext := range extensions {
+		if !strings.HasSuffix(name, fmt.Sprintf(".%s", ext)) {
+			continue
+		}
+		hasher := sha256.New()
+		if _, err := hasher.Write([]byte(name)); err != nil {
+			return "", err
+		}
+
+		dt := time.Now().Format("02.T_150405")
+		h := hex.EncodeToString(hasher.Sum(nil))[0:7]
+		name = fmt.Sprintf("%s.%s.%s", dt, h, ext)
+		break
+	}
+	return name, nil
+}
+
+// save streams a file into the store (via a temporary file so partial files are never visible by name)
+func (u *uploadContext) save(fileName string, r io.Reader) error {
+	name, err := uploadName(fileName, u.extensions)
+	if err != nil {
+		return err
+	}
+	f, err := os.CreateTemp(u.store, ".upload-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+	if u.maxFile > 0 {
+		r = io.LimitReader(r, u.maxFile+1)
+	}
+	n, err := io.Copy(f, r)
+	if err != nil {
+		return err
+	}
+	if u.maxFile > 0 && n > u.maxFile {
+		return errUploadTooLarge
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	// temporary files are private, stored files are not
+	if err := os.Chmod(f.Name(), 0o644); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), filepath.Join(u.store, name))
+}
+
+func uploadHandler(w http.ResponseWriter, r *http.Request, u *uploadContext) error {
 	if r.Method != "POST" {
 		return nil
 	}
 
-	// 32 MB is the default used by FormFile()
-	if err := r.ParseMultipartForm(32 << 20); err != nil {
+	if u.maxRequest > 0 {
+		r.Body = http.MaxBytesReader(w, r.Body, u.maxRequest)
+	}
+	reader, err := r.MultipartReader()
+	if err != nil {
 		return err
 	}
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if part.FormName() != "file" || part.FileName() == "" {
+			part.Close()
+			continue
+		}
+		err = u.save(part.FileName(), part)
+		part.Close()
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// uploadTooLarge indicates the error is from a size limit
+func uploadTooLarge(err error) bool {
+	var maxErr *http.MaxBytesError
+	return errors.Is(err, errUploadTooLarge) || errors.As(err, &maxErr)
+}
+
+// uploadID indicates a name is a resumable upload id (other files may share the uploads directory)
+func uploadID(id string) bool {
+	_, err := hex.DecodeString(id)
+	return err == nil && len(id) == 32
+}
+
+func (u *uploadContext) infoFile(id string) string {
+	return filepath.Join(u.uploads, fmt.Sprintf("%s.json", id))
+}
 
-	files := r.MultipartForm.File["file"]
-	for _, fileHeader := range files {
-		file, err := fileHeader.Open()
+func (u *uploadContext) dataFile(id string) string {
+	return filepath.Join(u.uploads, id)
+}
+
+func (u *uploadContext) info(id string) (uploadInfo, error) {
+	var info uploadInfo
+	b, err := os.ReadFile(u.infoFile(id))
+	if err != nil {
+		return info, err
+	}
+	err = json.Unmarshal(b, &info)
+	return info, err
+}
+
+// lock marks a resumable upload as in use (concurrent requests for an upload conflict)
+func (u *uploadContext) lock(id string) bool {
+	u.mutex.Lock()
+	defer u.mutex.Unlock()
+	if u.active[id] {
+		return false
+	}
+	u.active[id] = true
+	return true
+}
+
+func (u *uploadContext) unlock(id string) {
+	u.mutex.Lock()
+	defer u.mutex.Unlock()
+	delete(u.active, id)
+}
+
+// expire removes resumable uploads that were never completed
+func (u *uploadContext) expire() {
+	entries, err := os.ReadDir(u.uploads)
+	if err != nil {
+		return
+	}
+	for _, entry := range entries {
+		id, ok := strings.CutSuffix(entry.Name(), ".json")
+		if !ok || !uploadID(id) {
+			continue
+		}
+		info, err := u.info(id)
+		if err != nil || time.Since(info.Created) < uploadExpiry || !u.lock(id) {
+			continue
+		}
+		os.Remove(u.dataFile(id))
+		os.Remove(u.infoFile(id))
+		u.unlock(id)
+	}
+}
+
+// complete moves a finished resumable upload into the store (it is only copied across filesystems)
+func (u *uploadContext) complete(id string, info uploadInfo) error {
+	name, err := uploadName(info.Name, u.extensions)
+	if err != nil {
+		return err
+	}
+	data := u.dataFile(id)
+	if err := os.Chmod(data, 0o644); err != nil {
+		return err
+	}
+	err = os.Rename(data, filepath.Join(u.store, name))
+	if errors.Is(err, syscall.EXDEV) {
+		f, err := os.Open(data)
 		if err != nil {
 			return err
 		}
+		defer f.Close()
+		if err := u.save(info.Name, f); err != nil {
+			return err
+		}
+		os.Remove(data)
+	} else if err != nil {
+		return err
+	}
+	return os.Remove(u.infoFile(id))
+}
 
-		defer file.Close()
-		name := strings.ToLower(strings.TrimSpace(strings.ReplaceAll(string(fileHeader.Filename), " ", "-")))
-		for _, ext := range extensions {
-			if !strings.HasSuffix(name, fmt.Sprintf(".%s", ext)) {
-				continue
-			}
-			hasher := sha256.New()
-			if _, err := hasher.Write([]byte(name)); err != nil {
+func (s uploadStalled) Read(p []byte) (int, error) {
+	s.controller.SetReadDeadline(time.Now().Add(uploadStall))
+	return s.reader.Read(p)
+}
+
+// tusMetadata parses the Upload-Metadata header (comma separated "key base64(value)" pairs)
+func tusMetadata(header string) map[string]string {
+	result := make(map[string]string)
+	for _, pair := range strings.Split(header, ",") {
+		key, value, _ := strings.Cut(strings.TrimSpace(pair), " ")
+		if key == "" {
+			continue
+		}
+		decoded, err := base64.StdEncoding.DecodeString(value)
+		if err != nil {
+			continue
+		}
+		result[key] = string(decoded)
+	}
+	return result
+}
+
+// resumableHandler implements the tus (core, creation and termination) protocol
+func resumableHandler(w http.ResponseWriter, r *http.Request, u *uploadContext) error {
+	w.Header().Set("Tus-Resumable", tusVersion)
+	w.Header().Set("Cache-Control", "no-store")
+	if r.Method == http.MethodOptions {
+		w.Header().Set("Tus-Version", tusVersion)
+		w.Header().Set("Tus-Extension", "creation,termination")
+		if u.maxFile > 0 {
+			w.Header().Set("Tus-Max-Size", strconv.FormatInt(u.maxFile, 10))
+		}
+		w.WriteHeader(http.StatusNoContent)
+		return nil
+	}
+	if r.Header.Get("Tus-Resumable") != tusVersion {
+		w.Header().Set("Tus-Version", tusVersion)
+		w.WriteHeader(http.StatusPreconditionFailed)
+		return nil
+	}
+	id := strings.TrimPrefix(r.URL.Path, isResumable)
+	if r.Method == http.MethodPost {
+		if id != "" {
+			http.Error(w, "invalid upload", http.StatusBadRequest)
+			return nil
+		}
+		length, err := strconv.ParseInt(r.Header.Get("Upload-Length"), 10, 64)
+		if err != nil || length < 0 {
+			http.Error(w, "invalid Upload-Length", http.StatusBadRequest)
+			return nil
+		}
+		if u.maxFile > 0 && length > u.maxFile {
+			http.Error(w, errUploadTooLarge.Error(), http.StatusRequestEntityTooLarge)
+			return nil
+		}
+		info := uploadInfo{Name: tusMetadata(r.Header.Get("Upload-Metadata"))["filename"], Length: length, Created: time.Now()}
+		if _, err := uploadName(info.Name, u.extensions); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return nil
+		}
+		u.expire()
+		b := make([]byte, 16)
+		if _, err := rand.Read(b); err != nil {
+			return err
+		}
+		id = hex.EncodeToString(b)
+		if err := os.MkdirAll(u.uploads, 0o700); err != nil {
+			return err
+		}
+		if err := os.WriteFile(u.dataFile(id), nil, 0o600); err != nil {
+			return err
+		}
+		meta, err := json.Marshal(info)
+		if err != nil {
+			return err
+		}
+		if err := os.WriteFile(u.infoFile(id), meta, 0o600); err != nil {
+			return err
+		}
+		if length == 0 {
+			if err := u.complete(id, info); err != nil {
 				return err
 			}
-
-			dt := time.Now().Format("02.T_150405")
-			h := hex.EncodeToString(hasher.Sum(nil))[0:7]
-			name = fmt.Sprintf("%s.%s.%s", dt, h, ext)
-			break
 		}
-		target := filepath.Join(store, name)
-		f, err := os.Create(target)
+		w.Header().Set("Location", isResumable+id)
+		w.WriteHeader(http.StatusCreated)
+		return nil
+	}
+	if !uploadID(id) {
+		http.NotFound(w, r)
+		return nil
+	}
+	if r.Method == http.MethodHead {
+		// offsets are read without the lock so a stalled request never blocks resuming
+		info, err := u.info(id)
+		if err != nil {
+			http.NotFound(w, r)
+			return nil
+		}
+		stat, err := os.Stat(u.dataFile(id))
+		if err != nil {
+			http.NotFound(w, r)
+			return nil
+		}
+		w.Header().Set("Upload-Offset", strconv.FormatInt(stat.Size(), 10))
+		w.Header().Set("Upload-Length", strconv.FormatInt(info.Length, 10))
+		w.WriteHeader(http.StatusOK)
+		return nil
+	}
+	if !u.lock(id) {
+		http.Error(w, "upload in use", http.StatusLocked)
+		return nil
+	}
+	defer u.unlock(id)
+	info, err := u.info(id)
+	if err != nil {
+		http.NotFound(w, r)
+		return nil
+	}
+	stat, err := os.Stat(u.dataFile(id))
+	if err != nil {
+		return err
+	}
+	offset := stat.Size()
+	switch r.Method {
+	case http.MethodDelete:
+		os.Remove(u.dataFile(id))
+		if err := os.Remove(u.infoFile(id)); err != nil {
+			return err
+		}
+		w.WriteHeader(http.StatusNoContent)
+	case http.MethodPatch:
+		if r.Header.Get("Content-Type") != tusOctets {
+			http.Error(w, "invalid Content-Type", http.StatusUnsupportedMediaType)
+			return nil
+		}
+		requested, err := strconv.ParseInt(r.Header.Get("Upload-Offset"), 10, 64)
 		if err != nil {
+			http.Error(w, "invalid Upload-Offset", http.StatusBadRequest)
+			return nil
+		}
+		if requested != offset {
+			http.Error(w, "offset mismatch", http.StatusConflict)
+			return nil
+		}
+		body := io.Reader(uploadStalled{reader: r.Body, controller: http.NewResponseController(w)})
+		if u.maxRequest > 0 {
+			body = http.MaxBytesReader(w, io.NopCloser(body), u.maxRequest)
+		}
+		f, err := os.OpenFile(u.dataFile(id), os.O_WRONLY|os.O_APPEND, 0o600)
+		if err != nil {
+			return err
+		}
+		// received data is kept on errors, the client resumes from the new offset
+		n, copyErr := io.Copy(f, io.LimitReader(body, info.Length-offset))
+		if err := f.Close(); err != nil {
 			return err
 		}
+		offset += n
+		if copyErr != nil {
+			if uploadTooLarge(copyErr) {
+				http.Error(w, copyErr.Error(), http.StatusRequestEntityTooLarge)
+				return nil
+			}
+			return copyErr
+		}
+		if offset == info.Length {
+			if err := u.complete(id, info); err != nil {
+				return err
+			}
+		}
+		w.Header().Set("Upload-Offset", strconv.FormatInt(offset, 10))
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+	return nil
+}
 
-		defer f.Close()
+// uploadVerify checks a password against a bcrypt ($2a$, $2b$, $2y$) or argon2 ($argon2id$, $argon2i$) hash
+func uploadVerify(password, hash string) (bool, error) {
+	if strings.HasPrefix(hash, "$2") {
+		err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
+		if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+			return false, nil
+		}
+		return err == nil, err
+	}
+	// PHC format: $argon2id$v=19$m=65536,t=3,p=4$salt$key
+	parts := strings.Split(hash, "$")
+	if len(parts) != 6 || parts[0] != "" || (parts[1] != "argon2id" && parts[1] != "argon2i") {
+		return false, errors.New("unsupported password hash (bcrypt or argon2 required)")
+	}
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return false, fmt.Errorf("unsupported argon2 version: %s", parts[2])
+	}
+	var memory, iterations uint32
+	var threads uint8
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &memory, &iterations, &threads); err != nil {
+		return false, fmt.Errorf("invalid argon2 parameters: %s", parts[3])
+	}
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return false, err
+	}
+	key, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil {
+		return false, err
+	}
+	derive := argon2.IDKey
+	if parts[1] == "argon2i" {
+		derive = argon2.Key
+	}
+	return subtle.ConstantTimeCompare(key, derive([]byte(password), salt, iterations, memory, threads, uint32(len(key)))) == 1, nil
+}
+
+// uploadPasswords reads the htpasswd-style password file, lines are "user:hash"
+func uploadPasswords(path string) (map[string]string, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	result := make(map[string]string)
+	for _, line := range strings.Split(string(b), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		user, hash, ok := strings.Cut(line, ":")
+		if !ok {
+			return nil, fmt.Errorf("invalid password line for: %s", user)
+		}
+		result[user] = hash
+	}
+	return result, nil
+}
 
-		_, err = io.Copy(f, file)
+// uploadSecret reads the link signing secret, it is created when missing
+func uploadSecret(path string) ([]byte, error) {
+	b, err := os.ReadFile(path)
+	if err == nil {
+		return b, nil
+	}
+	if !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+	b = make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return nil, err
+	}
+	return b, os.WriteFile(path, b, 0o600)
+}
+
+func uploadSign(secret, payload []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write(payload)
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// uploadLink creates a token (expiry and nonce, signed) for a one-time upload link
+func uploadLink(secret []byte, expires time.Time) (string, error) {
+	payload := binary.BigEndian.AppendUint64(nil, uint64(expires.Unix()))
+	nonce := make([]byte, 16)
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	payload = append(payload, nonce...)
+	return fmt.Sprintf("%s.%s", base64.RawURLEncoding.EncodeToString(payload), uploadSign(secret, payload)), nil
+}
+
+// consume checks a link token and marks it used (used links are recorded until they expire)
+func (a *uploadAuth) consume(token string) (time.Time, error) {
+	encoded, signature, ok := strings.Cut(token, ".")
+	if !ok {
+		return time.Time{}, errors.New("invalid link")
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil || len(payload) != 24 || !hmac.Equal([]byte(signature), []byte(uploadSign(a.secret, payload))) {
+		return time.Time{}, errors.New("invalid link")
+	}
+	expires := time.Unix(int64(binary.BigEndian.Uint64(payload[:8])), 0)
+	if time.Now().After(expires) {
+		return time.Time{}, errors.New("expired link")
+	}
+	nonce := hex.EncodeToString(payload[8:])
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	used := make(map[string]int64)
+	if b, err := os.ReadFile(a.links); err == nil {
+		if err := json.Unmarshal(b, &used); err != nil {
+			return time.Time{}, err
+		}
+	}
+	if _, ok := used[nonce]; ok {
+		return time.Time{}, errors.New("link already used")
+	}
+	now := time.Now().Unix()
+	for key, expiry := range used {
+		if expiry < now {
+			delete(used, key)
+		}
+	}
+	used[nonce] = expires.Unix()
+	b, err := json.Marshal(used)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if err := os.MkdirAll(filepath.Dir(a.links), 0o700); err != nil {
+		return time.Time{}, err
+	}
+	return expires, os.WriteFile(a.links, b, 0o600)
+}
+
+// limited indicates a client has too many recent failures (and when it may retry)
+func (a *uploadAuth) limited(client string) (time.Duration, bool) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	var recent []time.Time
+	for _, t := range a.failures[client] {
+		if time.Since(t) < a.lockout {
+			recent = append(recent, t)
+		}
+	}
+	if len(recent) == 0 {
+		delete(a.failures, client)
+		return 0, false
+	}
+	a.failures[client] = recent
+	if len(recent) < a.maxFailures {
+		return 0, false
+	}
+	return a.lockout - time.Since(recent[0]), true
+}
+
+func (a *uploadAuth) fail(client string) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	a.failures[client] = append(a.failures[client], time.Now())
+}
+
+// authenticate gets the permission of a request, attempted is set when invalid credentials were given
+func (a *uploadAuth) authenticate(w http.ResponseWriter, r *http.Request) (permission string, attempted bool, err error) {
+	if cookie, err := r.Cookie(uploadCookie); err == nil {
+		a.mutex.Lock()
+		expires, ok := a.sessions[cookie.Value]
+		a.mutex.Unlock()
+		if ok && time.Now().Before(expires) {
+			return uploadPermission, false, nil
+		}
+	}
+	if token := r.URL.Query().Get("token"); token != "" && a.secret != nil {
+		a.mutex.Lock()
+		expires, err := a.consume(token)
+		a.mutex.Unlock()
 		if err != nil {
-			return err
+			return "", true, err
 		}
+		b := make([]byte, 32)
+		if _, err := rand.Read(b); err != nil {
+			return "", false, err
+		}
+		session := hex.EncodeToString(b)
+		a.mutex.Lock()
+		for key, expiry := range a.sessions {
+			if time.Now().After(expiry) {
+				delete(a.sessions, key)
+			}
+		}
+		a.sessions[session] = expires
+		a.mutex.Unlock()
+		http.SetCookie(w, &http.Cookie{Name: uploadCookie, Value: session, Path: "/", Expires: expires, HttpOnly: true, Secure: r.TLS != nil, SameSite: http.SameSiteStrictMode})
+		return uploadPermission, false, nil
+	}
+	user, password, ok := r.BasicAuth()
+	if !ok || a.passwords == "" {
+		return "", false, nil
+	}
+	passwords, err := uploadPasswords(a.passwords)
+	if err != nil {
+		return "", false, err
+	}
+	hash, ok := passwords[user]
+	if !ok {
+		return "", true, fmt.Errorf("unknown user: %s", user)
+	}
+	// verified credentials are cached (by hash) as each check is intentionally slow
+	sum := sha256.Sum256([]byte(strings.Join([]string{user, password, hash}, "\x00")))
+	key := hex.EncodeToString(sum[:])
+	a.mutex.Lock()
+	cached := a.verified[key]
+	a.mutex.Unlock()
+	if !cached {
+		valid, err := uploadVerify(password, hash)
+		if err != nil {
+			return "", false, err
+		}
+		if !valid {
+			return "", true, fmt.Errorf("invalid password for: %s", user)
+		}
+		a.mutex.Lock()
+		a.verified[key] = true
+		a.mutex.Unlock()
+	}
+	if slices.Contains(a.browse, user) {
+		return browsePermission, false, nil
 	}
+	return uploadPermission, false, nil
+}
 
-	return nil
+// guard requires a permission (browse includes upload) when authentication is configured
+func (u *uploadContext) guard(permission string, onError func(string, error), next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		a := u.auth
+		if a == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+		client, _, err := net.SplitHostPort(r.RemoteAddr)
+		if err != nil {
+			client = r.RemoteAddr
+		}
+		if wait, ok := a.limited(client); ok {
+			w.Header().Set("Retry-After", strconv.Itoa(int(wait.Seconds())+1))
+			http.Error(w, "too many failed attempts", http.StatusTooManyRequests)
+			return
+		}
+		granted, attempted, err := a.authenticate(w, r)
+		if err != nil {
+			onError("auth error", err)
+		}
+		if attempted {
+			a.fail(client)
+		}
+		if granted == "" {
+			w.Header().Set("WWW-Authenticate", `Basic realm="file-upload", charset="UTF-8"`)
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		if permission == browsePermission && granted != browsePermission {
+			http.Error(w, "forbidden", http.StatusForbidden)
+			return
+		}
+		if r.Method == http.MethodGet && r.URL.Query().Has("token") {
+			// drop the (used) token from the address
+			http.Redirect(w, r, r.URL.Path, http.StatusSeeOther)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// uploadPasswd sets a user password (read from stdin, stored as bcrypt) in the password file
+func uploadPasswd(path, user string) error {
+	if user == "" || strings.ContainsAny(user, ": \t") {
+		return fmt.Errorf("invalid user: %s", user)
+	}
+	fmt.Fprint(os.Stderr, "password: ")
+	password, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && !errors.Is(err, io.EOF) {
+		return err
+	}
+	password = strings.TrimRight(password, "\r\n")
+	if password == "" {
+		return errors.New("empty password")
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), uploadBcryptCost)
+	if err != nil {
+		return err
+	}
+	var lines []string
+	if b, err := os.ReadFile(path); err == nil {
+		for _, line := range strings.Split(strings.TrimSpace(string(b)), "\n") {
+			if line != "" && !strings.HasPrefix(line, fmt.Sprintf("%s:", user)) {
+				lines = append(lines, line)
+			}
+		}
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	lines = append(lines, fmt.Sprintf("%s:%s", user, hash))
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return err
+	}
+	return os.WriteFile(path, []byte(strings.Join(lines, "\n")+"\n"), 0o600)
 }
 
 // FileUploadApp handles file upload helper
 func FileUploadApp(a Args) error {
-	cfg := Configuration[struct {
-		Bind       string
-		Store      string
-		Extensions []string
-	}]{}
+	cfg := Configuration[uploadSettings]{}
 	if err := cfg.Load(a); err != nil {
 		return err
 	}
-	store := filepath.Join(os.Getenv("HOME"), cfg.Settings.Store)
+	home := os.Getenv("HOME")
+	store := filepath.Join(home, cfg.Settings.Store)
+	uploads := cfg.Settings.Uploads
+	if uploads == "" {
+		uploads = uploadUploads
+	}
+	u := &uploadContext{store: store, uploads: filepath.Join(home, uploads), extensions: cfg.Settings.Extensions, active: make(map[string]bool)}
+	var err error
+	if u.maxFile, err = uploadSize(cfg.Settings.MaxFileSize); err != nil {
+		return err
+	}
+	if u.maxRequest, err = uploadSize(cfg.Settings.MaxRequestSize); err != nil {
+		return err
+	}
+	auth := cfg.Settings.Auth
+	passwords := ""
+	if auth.Passwords != "" {
+		passwords = filepath.Join(home, auth.Passwords)
+	}
+	if len(os.Args) > 1 {
+		args := os.Args[2:]
+		switch os.Args[1] {
+		case "passwd":
+			if passwords == "" {
+				return errors.New("no password file configured")
+			}
+			if len(args) != 1 {
+				return errors.New("passwd requires a user")
+			}
+			return uploadPasswd(passwords, args[0])
+		case "link":
+			if auth.Secret == "" {
+				return errors.New("no link secret configured")
+			}
+			if len(args) > 1 {
+				return errors.New("link accepts an optional duration")
+			}
+			expiry := uploadLinkExpiry
+			if len(args) == 1 {
+				d, err := time.ParseDuration(args[0])
+				if err != nil {
+					return err
+				}
+				expiry = d
+			}
+			secret, err := uploadSecret(filepath.Join(home, auth.Secret))
+			if err != nil {
+				return err
+			}
+			token, err := uploadLink(secret, time.Now().Add(expiry))
+			if err != nil {
+				return err
+			}
+			base := auth.URL
+			if base == "" {
+				base = fmt.Sprintf("http://%s", cfg.Settings.Bind)
+			}
+			fmt.Printf("%s%s?token=%s\n", strings.TrimSuffix(base, "/"), isUpload, token)
+			return nil
+		default:
+			return fmt.Errorf("unknown command: %s", os.Args[1])
+		}
+	}
+	if passwords != "" || auth.Secret != "" {
+		u.auth = &uploadAuth{passwords: passwords, browse: auth.Browse, maxFailures: uploadFailures, lockout: uploadLockout, failures: make(map[string][]time.Time), sessions: make(map[string]time.Time), verified: make(map[string]bool)}
+		if auth.MaxFailures > 0 {
+			u.auth.maxFailures = auth.MaxFailures
+		}
+		if auth.Lockout != "" {
+			if u.auth.lockout, err = time.ParseDuration(auth.Lockout); err != nil {
+				return err
+			}
+		}
+		if auth.Secret != "" {
+			secret := filepath.Join(home, auth.Secret)
+			if u.auth.secret, err = uploadSecret(secret); err != nil {
+				return err
+			}
+			// used links are kept with the secret, never in the uploads directory (which is swept)
+			u.auth.links = filepath.Join(filepath.Dir(secret), uploadLinks)
+		}
+	}
 	downloadName := strings.ToLower(cfg.Settings.Store)
 	t, err := template.New("t").Parse(strings.Replace(indexHTML, downloadValue, downloadName, 1))
 	if err != nil {
@@ -160,22 +1047,35 @@ func FileUploadApp(a Args) error {
 		fmt.Fprintf(os.Stderr, "%s (%v)", text, err)
 	}
 	router := http.NewServeMux()
-	router.HandleFunc(isUploadTo, func(w http.ResponseWriter, r *http.Request) {
-		if err := uploadHandler(store, cfg.Settings.Extensions, r); err != nil {
+	router.Handle(isUploadTo, u.guard(uploadPermission, onError, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := uploadHandler(w, r, u); err != nil {
 			onError("upload error", err)
+			if uploadTooLarge(err) {
+				http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+				return
+			}
 		}
 		http.Redirect(w, r, isUpload, http.StatusSeeOther)
-	})
-	router.HandleFunc(isUpload, func(w http.ResponseWriter, _ *http.Request) {
+	})))
+	router.Handle(isResumable, u.guard(uploadPermission, onError, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := resumableHandler(w, r, u); err != nil {
+			onError("resumable upload error", err)
+			http.Error(w, "upload failed", http.StatusInternalServerError)
+		}
+	})))
+	router.Handle(isUpload, u.guard(uploadPermission, onError, http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
 		if err := t.Execute(w, nil); err != nil {
 			onError("template error", err)
 		}
-	})
+	})))
 	prefix := fmt.Sprintf("/%s/", downloadName)
-	router.Handle(prefix, http.StripPrefix(prefix, http.FileServer(http.Dir(store))))
+	router.Handle(prefix, u.guard(browsePermission, onError, http.StripPrefix(prefix, http.FileServer(http.Dir(store)))))
+	// no overall read timeout, large (form) uploads are slow, resumable uploads fail on stalls
 	s := &http.Server{
-		Addr:    cfg.Settings.Bind,
-		Handler: router,
+		Addr:              cfg.Settings.Bind,
+		Handler:           router,
+		ReadHeaderTimeout: uploadStall,
+		IdleTimeout:       2 * uploadStall,
 	}
 	return s.ListenAndServe()
 }
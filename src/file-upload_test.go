@@ -0,0 +1,79 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestUploadLinkReuseAfterExpire(t *testing.T) {
+	dir := t.TempDir()
+	u := &uploadContext{store: filepath.Join(dir, "store"), uploads: filepath.Join(dir, "uploads"), active: make(map[string]bool)}
+	if err := os.MkdirAll(u.uploads, 0o700); err != nil {
+		t.Fatal(err)
+	}
+	// the ledger shares the uploads directory to check the sweep skips it
+	auth := &uploadAuth{secret: []byte("secret"), links: filepath.Join(u.uploads, uploadLinks)}
+	stale := "0123456789abcdef0123456789abcdef"
+	meta, err := json.Marshal(uploadInfo{Name: "stale.txt", Created: time.Now().Add(-2 * uploadExpiry)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(u.infoFile(stale), meta, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(u.dataFile(stale), nil, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	token, err := uploadLink(auth.secret, time.Now().Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := auth.consume(token); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	u.expire()
+	if _, err := os.Stat(auth.links); err != nil {
+		t.Errorf("ledger removed: %v", err)
+	}
+	if _, err := os.Stat(u.infoFile(stale)); err == nil {
+		t.Error("stale upload not removed")
+	}
+	if _, err := auth.consume(token); err == nil {
+		t.Error("link reused after expire")
+	}
+}
+
+func TestUploadLinkInvalid(t *testing.T) {
+	auth := &uploadAuth{secret: []byte("secret"), links: filepath.Join(t.TempDir(), uploadLinks)}
+	token, err := uploadLink([]byte("other"), time.Now().Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := auth.consume(token); err == nil {
+		t.Error("invalid signature accepted")
+	}
+	token, err = uploadLink(auth.secret, time.Now().Add(-time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := auth.consume(token); err == nil {
+		t.Error("expired link accepted")
+	}
+}
+
+func TestUploadID(t *testing.T) {
+	for id, expect := range map[string]bool{
+		"0123456789abcdef0123456789abcdef": true,
+		"links":                            false,
+		"":                                 false,
+		"0123456789abcdef":                 false,
+		"0123456789abcdef0123456789abcdeg": false,
+	} {
+		if uploadID(id) != expect {
+			t.Errorf("%s: expected %v", id, expect)
+		}
+	}
+}
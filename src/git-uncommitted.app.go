@@ -2,34 +2,848 @@
 package main
 
 import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
+	"io"
+	"io/fs"
+	"net"
 	"os"
 	"os/exec"
+	"os/signal"
 	"path/filepath"
+	"runtime"
 	"sort"
 	"strings"
 	"sync"
+	"syscall"
+	"time"
+	"unsafe"
 )
 
-func uncommit(stdout chan string, dir string) {
-	cmd := exec.Command("git", "current-state")
+const (
+	uncommittedTimeout = 30 * time.Second
+	uncommittedFetch   = "fetch"
+	uncommittedPull    = "pull"
+	uncommittedPush    = "push"
+	uncommittedStdout  = "stdout"
+	uncommittedFile    = "file"
+	uncommittedDesktop = "notify"
+	uncommittedStatus  = "status"
+	uncommittedJSON    = "json"
+	uncommittedCSV     = "csv"
+	uncommittedSocket  = ".cache/git-uncommitted.sock"
+	// inotify: IN_MODIFY|IN_CLOSE_WRITE|IN_MOVED_FROM|IN_MOVED_TO|IN_CREATE|IN_DELETE|IN_DELETE_SELF|IN_MOVE_SELF
+	uncommittedWatchMask = 0x2 | 0x8 | 0x40 | 0x80 | 0x100 | 0x200 | 0x400 | 0x800
+	uncommittedOverflow  = 0x4000
+	uncommittedIgnored   = 0x8000
+	uncommittedCloexec   = 0x80000
+	uncommittedNewDir    = 0x80 | 0x100
+	uncommittedIsDir     = 0x40000000
+)
+
+// uncommittedInotify are the inotify_init1 and inotify_add_watch syscalls per architecture
+var uncommittedInotify = map[string][2]uintptr{
+	"amd64":   {294, 254},
+	"386":     {332, 292},
+	"arm64":   {26, 27},
+	"riscv64": {26, 27},
+	"arm":     {360, 317},
+}
+
+type (
+	uncommittedSettings struct {
+		Directories []string
+		Workers     int
+		Timeout     string
+		Outputs     []uncommittedOutput
+		Watch       struct {
+			Socket   string
+			Debounce string
+			Refresh  string
+		}
+	}
+	uncommittedWatcher struct {
+		fd      int
+		add     uintptr
+		watches map[int32]string
+		paths   map[int32]string
+		events  chan uncommittedEvent
+	}
+	uncommittedEvent struct {
+		wd   int32
+		mask uint32
+		name string
+	}
+	uncommittedOutput struct {
+		Type    string
+		Path    string
+		Command []string
+	}
+	uncommittedRepo struct {
+		Path    string
+		Branch  string
+		Head    string
+		Remotes map[string]string
+	}
+	uncommittedEntry struct {
+		line     string
+		repo     string
+		category string
+	}
+	uncommittedRow struct {
+		repo   string
+		branch string
+		action string
+		result string
+	}
+)
+
+func (s uncommittedSettings) workers() int {
+	if s.Workers > 0 {
+		return s.Workers
+	}
+	return runtime.NumCPU()
+}
+
+func (s uncommittedSettings) timeout() (time.Duration, error) {
+	if s.Timeout == "" {
+		return uncommittedTimeout, nil
+	}
+	d, err := time.ParseDuration(s.Timeout)
+	if err != nil {
+		return 0, err
+	}
+	if d <= 0 {
+		return 0, fmt.Errorf("invalid timeout: %s", s.Timeout)
+	}
+	return d, nil
+}
+
+// uncommittedRepos finds every git repository that is a direct child of the directories
+func uncommittedRepos(home string, dirs []string) []string {
+	var repos []string
+	for _, dir := range dirs {
+		path := filepath.Join(home, dir)
+		children, err := os.ReadDir(path)
+		if err != nil {
+			continue
+		}
+		for _, child := range children {
+			childPath := filepath.Join(path, child.Name())
+			if !PathExists(filepath.Join(childPath, ".git")) {
+				continue
+			}
+			repos = append(repos, childPath)
+		}
+	}
+	sort.Strings(repos)
+	return repos
+}
+
+// uncommittedCommand creates a git command that is killed (with any children, e.g. ssh) on timeout
+func uncommittedCommand(ctx context.Context, dir string, args ...string) *exec.Cmd {
+	cmd := exec.CommandContext(ctx, "git", args...)
 	cmd.Dir = dir
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	cmd.Cancel = func() error {
+		return syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+	}
+	// children that still hold the output pipes must not block waiting
+	cmd.WaitDelay = time.Second
+	return cmd
+}
+
+func uncommit(timeout time.Duration, dir string) string {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	cmd := uncommittedCommand(ctx, dir, "current-state")
 	cmd.Stderr = os.Stderr
 	out, err := cmd.Output()
-	if err == nil {
-		res := strings.TrimSpace(string(out))
-		if res != "" {
-			stdout <- res
+	if err != nil {
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			return fmt.Sprintf("-> %s (timeout)", dir)
+		}
+		return ""
+	}
+	return strings.TrimSpace(string(out))
+}
+
+func uncommittedGit(ctx context.Context, dir string, args ...string) (string, error) {
+	cmd := uncommittedCommand(ctx, dir, args...)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			return "", errors.New("timeout")
+		}
+		if msg, _, _ := strings.Cut(strings.TrimSpace(stderr.String()), "\n"); msg != "" {
+			return "", errors.New(msg)
+		}
+		return "", err
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+// uncommittedBlocked gives a reason the repository should not be touched (if any)
+func uncommittedBlocked(ctx context.Context, dir string) (string, error) {
+	gitDir, err := uncommittedGit(ctx, dir, "rev-parse", "--absolute-git-dir")
+	if err != nil {
+		return "", err
+	}
+	for _, pending := range []string{"rebase-merge", "rebase-apply", "MERGE_HEAD", "CHERRY_PICK_HEAD", "REVERT_HEAD"} {
+		if PathExists(filepath.Join(gitDir, pending)) {
+			return fmt.Sprintf("in progress (%s)", strings.ToLower(pending)), nil
+		}
+	}
+	status, err := uncommittedGit(ctx, dir, "status", "--porcelain")
+	if err != nil {
+		return "", err
+	}
+	if status != "" {
+		return "dirty", nil
+	}
+	return "", nil
+}
+
+func uncommittedAction(timeout time.Duration, action, home, dir string) []uncommittedRow {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	repo := strings.TrimPrefix(dir, home)
+	row := func(branch, result string) []uncommittedRow {
+		return []uncommittedRow{{repo, branch, action, result}}
+	}
+	failed := func(branch string, err error) []uncommittedRow {
+		return row(branch, fmt.Sprintf("failed: %v", err))
+	}
+	branch, err := uncommittedGit(ctx, dir, "branch", "--show-current")
+	if err != nil {
+		return failed("", err)
+	}
+	if branch == "" {
+		branch = "(detached)"
+	}
+	reason, err := uncommittedBlocked(ctx, dir)
+	if err != nil {
+		return failed(branch, err)
+	}
+	if reason != "" {
+		return row(branch, fmt.Sprintf("refused: %s", reason))
+	}
+	switch action {
+	case uncommittedFetch:
+		if _, err := uncommittedGit(ctx, dir, "fetch", "--all", "--prune"); err != nil {
+			return failed(branch, err)
+		}
+	case uncommittedPull:
+		if branch == "(detached)" {
+			return row(branch, "refused: detached")
+		}
+		if _, err := uncommittedGit(ctx, dir, "pull", "--ff-only"); err != nil {
+			return failed(branch, err)
+		}
+	case uncommittedPush:
+		refs, err := uncommittedGit(ctx, dir, "for-each-ref", "--format=%(refname:short) %(upstream:remotename) %(upstream:remoteref) %(upstream:track)", "refs/heads")
+		if err != nil {
+			return failed(branch, err)
+		}
+		var rows []uncommittedRow
+		for _, line := range strings.Split(refs, "\n") {
+			fields := strings.Fields(line)
+			if len(fields) < 4 || !strings.Contains(line, "ahead") {
+				continue
+			}
+			local, remote, ref := fields[0], fields[1], fields[2]
+			result := "ok"
+			if _, err := uncommittedGit(ctx, dir, "push", remote, fmt.Sprintf("%s:%s", local, ref)); err != nil {
+				result = fmt.Sprintf("failed: %v", err)
+			}
+			rows = append(rows, uncommittedRow{repo, local, action, result})
+		}
+		if len(rows) == 0 {
+			return row(branch, "up-to-date")
+		}
+		return rows
+	}
+	return row(branch, "ok")
+}
+
+func uncommittedTable(rows []uncommittedRow) {
+	header := uncommittedRow{"repo", "branch", "action", "result"}
+	widths := []int{len(header.repo), len(header.branch), len(header.action)}
+	for _, r := range rows {
+		widths[0] = max(widths[0], len(r.repo))
+		widths[1] = max(widths[1], len(r.branch))
+		widths[2] = max(widths[2], len(r.action))
+	}
+	formatter := fmt.Sprintf("%%-%ds  %%-%ds  %%-%ds  %%s\n", widths[0], widths[1], widths[2])
+	for _, r := range append([]uncommittedRow{header}, rows...) {
+		fmt.Printf(formatter, r.repo, r.branch, r.action, r.result)
+	}
+}
+
+func newUncommittedEntry(line string) uncommittedEntry {
+	entry := uncommittedEntry{line: line, category: "other"}
+	trimmed, ok := strings.CutPrefix(line, "-> ")
+	if !ok {
+		return entry
+	}
+	idx := strings.LastIndex(trimmed, " (")
+	if idx < 0 || !strings.HasSuffix(trimmed, ")") {
+		return entry
+	}
+	entry.repo = trimmed[:idx]
+	switch cmd := trimmed[idx+2 : len(trimmed)-1]; cmd {
+	case "update-index", "diff-index":
+		entry.category = "dirty"
+	case "log":
+		entry.category = "unpushed"
+	case "ls-files":
+		entry.category = "untracked"
+	default:
+		entry.category = cmd
+	}
+	return entry
+}
+
+func uncommittedLines(entries []uncommittedEntry, prefix string) string {
+	var lines []string
+	for _, e := range entries {
+		lines = append(lines, fmt.Sprintf("%s%s", prefix, e.line))
+	}
+	return strings.Join(lines, "\n")
+}
+
+func uncommittedMessage(entries []uncommittedEntry) string {
+	if len(entries) == 0 {
+		return ""
+	}
+	return fmt.Sprintf("uncommitted\n===\n%s\n", uncommittedLines(entries, "  "))
+}
+
+// uncommittedSummary gives counts per category (e.g. for status bars)
+func uncommittedSummary(entries []uncommittedEntry) string {
+	counts := make(map[string]int)
+	for _, e := range entries {
+		counts[e.category]++
+	}
+	var categories []string
+	for k := range counts {
+		categories = append(categories, k)
+	}
+	sort.Strings(categories)
+	var parts []string
+	for _, c := range categories {
+		parts = append(parts, fmt.Sprintf("%s:%d", c, counts[c]))
+	}
+	return strings.Join(parts, " ")
+}
+
+func uncommittedNotify(outputs []uncommittedOutput, entries []uncommittedEntry) error {
+	if len(outputs) == 0 {
+		outputs = []uncommittedOutput{{Type: uncommittedStdout}}
+	}
+	home := os.Getenv("HOME")
+	write := func(path, text string) error {
+		if path == "" {
+			if text != "" {
+				fmt.Print(text)
+			}
+			return nil
+		}
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(home, path)
+		}
+		return os.WriteFile(path, []byte(text), 0o644)
+	}
+	var errs []error
+	for _, o := range outputs {
+		var err error
+		switch o.Type {
+		case uncommittedStdout:
+			err = write("", uncommittedMessage(entries))
+		case uncommittedFile:
+			if o.Path == "" {
+				err = errors.New("file output requires a path")
+				break
+			}
+			err = write(o.Path, uncommittedMessage(entries))
+		case uncommittedStatus:
+			summary := uncommittedSummary(entries)
+			if summary != "" {
+				summary = fmt.Sprintf("%s\n", summary)
+			}
+			err = write(o.Path, summary)
+		case uncommittedDesktop:
+			if len(o.Command) == 0 {
+				err = errors.New("notify output requires a command")
+				break
+			}
+			if len(entries) == 0 {
+				break
+			}
+			args := append([]string{}, o.Command[1:]...)
+			args = append(args, "uncommitted", uncommittedLines(entries, ""))
+			err = exec.Command(o.Command[0], args...).Run()
+		default:
+			err = fmt.Errorf("unknown output type: %s", o.Type)
+		}
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func newUncommittedRepo(timeout time.Duration, home, dir string) uncommittedRepo {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	repo := uncommittedRepo{Path: strings.TrimPrefix(dir, home), Remotes: make(map[string]string)}
+	repo.Branch, _ = uncommittedGit(ctx, dir, "branch", "--show-current")
+	repo.Head, _ = uncommittedGit(ctx, dir, "rev-parse", "--verify", "-q", "HEAD")
+	remotes, _ := uncommittedGit(ctx, dir, "remote", "-v")
+	for _, line := range strings.Split(remotes, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 3 && fields[2] == "(fetch)" {
+			repo.Remotes[fields[0]] = fields[1]
+		}
+	}
+	return repo
+}
+
+func writeUncommittedInventory(buf *bytes.Buffer, format string, inventory []uncommittedRepo) error {
+	switch format {
+	case uncommittedJSON:
+		b, err := json.MarshalIndent(inventory, "", "  ")
+		if err != nil {
+			return err
+		}
+		buf.Write(b)
+		buf.WriteString("\n")
+		return nil
+	case uncommittedCSV:
+		w := csv.NewWriter(buf)
+		if err := w.Write([]string{"path", "branch", "head", "remotes"}); err != nil {
+			return err
+		}
+		for _, r := range inventory {
+			var remotes []string
+			for name, url := range r.Remotes {
+				remotes = append(remotes, fmt.Sprintf("%s=%s", name, url))
+			}
+			sort.Strings(remotes)
+			if err := w.Write([]string{r.Path, r.Branch, r.Head, strings.Join(remotes, ";")}); err != nil {
+				return err
+			}
+		}
+		w.Flush()
+		return w.Error()
+	}
+	return fmt.Errorf("unknown inventory format: %s", format)
+}
+
+func readUncommittedInventory(file string) ([]uncommittedRepo, error) {
+	b, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	var inventory []uncommittedRepo
+	if !strings.HasSuffix(file, fmt.Sprintf(".%s", uncommittedCSV)) {
+		if err := json.Unmarshal(b, &inventory); err != nil {
+			return nil, err
+		}
+		return inventory, nil
+	}
+	records, err := csv.NewReader(bytes.NewReader(b)).ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	for idx, record := range records {
+		if idx == 0 {
+			continue
+		}
+		if len(record) != 4 {
+			return nil, fmt.Errorf("invalid inventory record: %v", record)
+		}
+		repo := uncommittedRepo{Path: record[0], Branch: record[1], Head: record[2], Remotes: make(map[string]string)}
+		for _, remote := range strings.Split(record[3], ";") {
+			if name, url, ok := strings.Cut(remote, "="); ok {
+				repo.Remotes[name] = url
+			}
+		}
+		inventory = append(inventory, repo)
+	}
+	return inventory, nil
+}
+
+// compareUncommittedInventory prints the drift between inventories and returns repositories only on the right
+func compareUncommittedInventory(left, right []uncommittedRepo) []uncommittedRepo {
+	index := func(inventory []uncommittedRepo) map[string]uncommittedRepo {
+		m := make(map[string]uncommittedRepo)
+		for _, r := range inventory {
+			m[r.Path] = r
+		}
+		return m
+	}
+	lefts := index(left)
+	rights := index(right)
+	var paths []string
+	for p := range lefts {
+		paths = append(paths, p)
+	}
+	for p := range rights {
+		if _, ok := lefts[p]; !ok {
+			paths = append(paths, p)
+		}
+	}
+	sort.Strings(paths)
+	var missing []uncommittedRepo
+	for _, p := range paths {
+		l, inLeft := lefts[p]
+		r, inRight := rights[p]
+		switch {
+		case !inRight:
+			fmt.Printf("- %s\n", p)
+			continue
+		case !inLeft:
+			fmt.Printf("+ %s\n", p)
+			missing = append(missing, r)
+			continue
+		}
+		var names []string
+		for name := range l.Remotes {
+			names = append(names, name)
+		}
+		for name := range r.Remotes {
+			if _, ok := l.Remotes[name]; !ok {
+				names = append(names, name)
+			}
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			if l.Remotes[name] != r.Remotes[name] {
+				fmt.Printf("~ %s remote %s: %s -> %s\n", p, name, l.Remotes[name], r.Remotes[name])
+			}
+		}
+		if l.Head != r.Head {
+			fmt.Printf("~ %s head: %s -> %s\n", p, l.Head, r.Head)
+		}
+	}
+	return missing
+}
+
+func cloneUncommittedRepos(home string, repos []uncommittedRepo) error {
+	var errs []error
+	for _, r := range repos {
+		url, ok := r.Remotes["origin"]
+		if !ok {
+			var names []string
+			for name := range r.Remotes {
+				names = append(names, name)
+			}
+			if len(names) == 0 {
+				fmt.Printf("no remote, skipping: %s\n", r.Path)
+				continue
+			}
+			sort.Strings(names)
+			url = r.Remotes[names[0]]
+		}
+		target := filepath.Join(home, r.Path)
+		if PathExists(target) {
+			fmt.Printf("exists, skipping: %s\n", r.Path)
+			continue
+		}
+		fmt.Printf("cloning: %s\n", r.Path)
+		cmd := exec.Command("git", "clone", url, target)
+		cmd.Stdout = os.Stdout
+		cmd.Stderr = os.Stderr
+		if err := cmd.Run(); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", r.Path, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func newUncommittedWatcher() (*uncommittedWatcher, error) {
+	calls, ok := uncommittedInotify[runtime.GOARCH]
+	if runtime.GOOS != "linux" || !ok {
+		return nil, fmt.Errorf("watch is not supported on %s/%s", runtime.GOOS, runtime.GOARCH)
+	}
+	fd, _, errno := syscall.Syscall(calls[0], uncommittedCloexec, 0, 0)
+	if errno != 0 {
+		return nil, errno
+	}
+	w := &uncommittedWatcher{fd: int(fd), add: calls[1], watches: make(map[int32]string), paths: make(map[int32]string), events: make(chan uncommittedEvent, 256)}
+	go w.read()
+	return w, nil
+}
+
+func (w *uncommittedWatcher) watch(path, repo string) error {
+	p, err := syscall.BytePtrFromString(path)
+	if err != nil {
+		return err
+	}
+	wd, _, errno := syscall.Syscall(w.add, uintptr(w.fd), uintptr(unsafe.Pointer(p)), uncommittedWatchMask)
+	if errno != 0 {
+		return fmt.Errorf("%s: %w", path, errno)
+	}
+	w.watches[int32(wd)] = repo
+	w.paths[int32(wd)] = path
+	return nil
+}
+
+// watchTree watches the worktree directories under root (inotify is not recursive), skipping git
+// metadata, nested repositories and ignored directories
+func (w *uncommittedWatcher) watchTree(repo, root string) error {
+	rel, err := filepath.Rel(repo, root)
+	if err != nil {
+		return err
+	}
+	out, err := exec.Command("git", "-C", repo, "ls-files", "--others", "--ignored", "--exclude-standard", "--directory", "--", rel).Output()
+	if err != nil {
+		return err
+	}
+	ignored := make(map[string]bool)
+	for _, line := range strings.Split(string(out), "\n") {
+		if dir, ok := strings.CutSuffix(line, "/"); ok {
+			ignored[filepath.Join(repo, dir)] = true
+		}
+	}
+	return filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || !d.IsDir() {
+			return nil
+		}
+		if d.Name() == ".git" || ignored[path] || (path != repo && PathExists(filepath.Join(path, ".git"))) {
+			return filepath.SkipDir
+		}
+		return w.watch(path, repo)
+	})
+}
+
+func (w *uncommittedWatcher) read() {
+	const header = 16
+	buf := make([]byte, 64*1024)
+	for {
+		n, err := syscall.Read(w.fd, buf)
+		if err != nil {
+			if errors.Is(err, syscall.EINTR) {
+				continue
+			}
+			close(w.events)
 			return
 		}
+		for offset := 0; offset+header <= n; {
+			event := uncommittedEvent{
+				wd:   int32(binary.NativeEndian.Uint32(buf[offset:])),
+				mask: binary.NativeEndian.Uint32(buf[offset+4:]),
+			}
+			length := int(binary.NativeEndian.Uint32(buf[offset+12:]))
+			name := buf[offset+header : offset+header+length]
+			if idx := bytes.IndexByte(name, 0); idx >= 0 {
+				name = name[:idx]
+			}
+			event.name = string(name)
+			w.events <- event
+			offset += header + length
+		}
+	}
+}
+
+// uncommittedWatch keeps the state of repositories current and serves it over a unix socket
+func uncommittedWatch(settings uncommittedSettings, timeout time.Duration, home string) error {
+	duration := func(value string, fallback time.Duration) (time.Duration, error) {
+		if value == "" {
+			return fallback, nil
+		}
+		return time.ParseDuration(value)
+	}
+	debounce, err := duration(settings.Watch.Debounce, 500*time.Millisecond)
+	if err != nil {
+		return err
+	}
+	refresh, err := duration(settings.Watch.Refresh, 5*time.Minute)
+	if err != nil {
+		return err
+	}
+	w, err := newUncommittedWatcher()
+	if err != nil {
+		return err
+	}
+	socket := uncommittedSocketPath(settings, home)
+	if err := os.MkdirAll(filepath.Dir(socket), 0o755); err != nil {
+		return err
+	}
+	os.Remove(socket)
+	listener, err := net.Listen("unix", socket)
+	if err != nil {
+		return err
+	}
+	defer listener.Close()
+
+	var lock sync.Mutex
+	state := make(map[string]string)
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			lock.Lock()
+			var entries []uncommittedEntry
+			for _, res := range state {
+				if res == "" {
+					continue
+				}
+				for _, line := range strings.Split(res, "\n") {
+					entries = append(entries, newUncommittedEntry(strings.Replace(line, home, "", 1)))
+				}
+			}
+			lock.Unlock()
+			sort.Slice(entries, func(i, j int) bool {
+				return entries[i].line < entries[j].line
+			})
+			text := uncommittedSummary(entries) + "\n"
+			if len(entries) > 0 {
+				text += uncommittedLines(entries, "") + "\n"
+			}
+			io.WriteString(conn, text)
+			conn.Close()
+		}
+	}()
+
+	watched := make(map[string]bool)
+	dirty := make(map[string]bool)
+	scan := func() {
+		for _, dir := range settings.Directories {
+			path := filepath.Join(home, dir)
+			if !watched[path] && w.watch(path, "") == nil {
+				watched[path] = true
+			}
+		}
+		repos := uncommittedRepos(home, settings.Directories)
+		lock.Lock()
+		for repo := range state {
+			if !PathExists(repo) {
+				delete(state, repo)
+				delete(watched, repo)
+			}
+		}
+		lock.Unlock()
+		for _, repo := range repos {
+			if watched[repo] {
+				continue
+			}
+			dirty[repo] = true
+			if err := w.watchTree(repo, repo); err != nil {
+				fmt.Fprintf(os.Stderr, "unable to watch: %v\n", err)
+			}
+			for _, path := range []string{filepath.Join(repo, ".git"), filepath.Join(repo, ".git", "refs", "heads")} {
+				if !PathExists(path) {
+					continue
+				}
+				if err := w.watch(path, repo); err != nil {
+					fmt.Fprintf(os.Stderr, "unable to watch: %v\n", err)
+				}
+			}
+			watched[repo] = true
+		}
+	}
+	update := func() {
+		var repos []string
+		for repo := range dirty {
+			repos = append(repos, repo)
+		}
+		clear(dirty)
+		sort.Strings(repos)
+		results := Parallel(settings.workers(), len(repos), func(idx int) string {
+			return uncommit(timeout, repos[idx])
+		})
+		lock.Lock()
+		defer lock.Unlock()
+		for idx, repo := range repos {
+			state[repo] = results[idx]
+		}
+	}
+	scan()
+	update()
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	timer := time.NewTimer(debounce)
+	timer.Stop()
+	ticker := time.NewTicker(refresh)
+	defer ticker.Stop()
+	for {
+		select {
+		case event, ok := <-w.events:
+			if !ok {
+				return errors.New("inotify watch closed")
+			}
+			repo, known := w.watches[event.wd]
+			parent := w.paths[event.wd]
+			if event.mask&uncommittedIgnored != 0 {
+				delete(w.watches, event.wd)
+				delete(w.paths, event.wd)
+			}
+			if known && repo != "" && event.mask&uncommittedIsDir != 0 && event.mask&uncommittedNewDir != 0 {
+				if meta := filepath.Join(repo, ".git"); parent != meta && !strings.HasPrefix(parent, meta+string(filepath.Separator)) {
+					if err := w.watchTree(repo, filepath.Join(parent, event.name)); err != nil {
+						fmt.Fprintf(os.Stderr, "unable to watch: %v\n", err)
+					}
+				}
+			}
+			switch {
+			case event.mask&uncommittedOverflow != 0:
+				scan()
+			case strings.HasSuffix(event.name, ".lock"):
+				continue
+			case !known:
+				continue
+			case repo == "":
+				scan()
+			default:
+				dirty[repo] = true
+			}
+			timer.Reset(debounce)
+		case <-timer.C:
+			update()
+		case <-ticker.C:
+			scan()
+			lock.Lock()
+			for repo := range state {
+				dirty[repo] = true
+			}
+			lock.Unlock()
+			update()
+		case <-signals:
+			return nil
+		}
+	}
+}
+
+func uncommittedSocketPath(settings uncommittedSettings, home string) string {
+	socket := settings.Watch.Socket
+	if socket == "" {
+		socket = uncommittedSocket
 	}
-	stdout <- ""
+	if filepath.IsAbs(socket) {
+		return socket
+	}
+	return filepath.Join(home, socket)
 }
 
 // GitUncommittedApp handles a summary of repositories across a set of directories
 func GitUncommittedApp(a Args) error {
 	mode := flag.String("mode", "", "operating mode")
+	format := flag.String("format", uncommittedJSON, "inventory format (json or csv)")
+	output := flag.String("output", "", "inventory output file")
+	clone := flag.Bool("clone", false, "clone repositories missing locally when comparing")
 	flag.Parse()
 	op := *mode
 	if op == "pwd" {
@@ -46,59 +860,103 @@ func GitUncommittedApp(a Args) error {
 		}
 		return nil
 	}
-	cfg := Configuration[struct {
-		Directories []string
-	}]{}
+	cfg := Configuration[uncommittedSettings]{}
 	if err := cfg.Load(a); err != nil {
 		return err
 	}
+	timeout, err := cfg.Settings.timeout()
+	if err != nil {
+		return err
+	}
 
-	var wg sync.WaitGroup
-	var all []chan string
 	home := fmt.Sprintf("%s%c", os.Getenv("HOME"), os.PathSeparator)
-	for _, dir := range cfg.Settings.Directories {
-		wg.Add(1)
-		go func(d string) {
-			defer wg.Done()
-			path := filepath.Join(home, d)
-			children, err := os.ReadDir(path)
-			if err != nil {
-				return
+	repos := uncommittedRepos(home, cfg.Settings.Directories)
+	switch op {
+	case "watch":
+		return uncommittedWatch(cfg.Settings, timeout, home)
+	case "query":
+		conn, err := net.Dial("unix", uncommittedSocketPath(cfg.Settings, home))
+		if err != nil {
+			return err
+		}
+		defer conn.Close()
+		_, err = io.Copy(os.Stdout, conn)
+		return err
+	case "inventory":
+		inventory := Parallel(cfg.Settings.workers(), len(repos), func(idx int) uncommittedRepo {
+			return newUncommittedRepo(timeout, home, repos[idx])
+		})
+		var buf bytes.Buffer
+		if err := writeUncommittedInventory(&buf, *format, inventory); err != nil {
+			return err
+		}
+		if *output == "" {
+			fmt.Print(buf.String())
+			return nil
+		}
+		return os.WriteFile(*output, buf.Bytes(), 0o644)
+	case "compare":
+		var left, right []uncommittedRepo
+		switch args := flag.Args(); len(args) {
+		case 1:
+			left = Parallel(cfg.Settings.workers(), len(repos), func(idx int) uncommittedRepo {
+				return newUncommittedRepo(timeout, home, repos[idx])
+			})
+			right, err = readUncommittedInventory(args[0])
+		case 2:
+			left, err = readUncommittedInventory(args[0])
+			if err == nil {
+				right, err = readUncommittedInventory(args[1])
 			}
-			for _, child := range children {
-				childPath := filepath.Join(path, child.Name())
-				if !PathExists(filepath.Join(childPath, ".git")) {
-					continue
+		default:
+			return errors.New("compare requires one or two manifests")
+		}
+		if err != nil {
+			return err
+		}
+		missing := compareUncommittedInventory(left, right)
+		if !*clone {
+			return nil
+		}
+		return cloneUncommittedRepos(home, missing)
+	case uncommittedFetch, uncommittedPull, uncommittedPush:
+		var rows []uncommittedRow
+		failures := 0
+		for _, set := range Parallel(cfg.Settings.workers(), len(repos), func(idx int) []uncommittedRow {
+			return uncommittedAction(timeout, op, home, repos[idx])
+		}) {
+			for _, r := range set {
+				if strings.HasPrefix(r.result, "failed") {
+					failures++
 				}
-				r := make(chan string)
-				go func(dir string, out chan string) {
-					uncommit(out, dir)
-				}(childPath, r)
-				all = append(all, r)
-			}
-		}(dir)
-	}
-	wg.Wait()
-	var results []string
-	prefix := ""
-	isMessage := op == "motd"
-	if isMessage {
-		prefix = "  "
-	}
-	for _, a := range all {
-		res := <-a
+			}
+			rows = append(rows, set...)
+		}
+		uncommittedTable(rows)
+		if failures > 0 {
+			return fmt.Errorf("%s failed for %d branches/repositories", op, failures)
+		}
+		return nil
+	}
+	all := Parallel(cfg.Settings.workers(), len(repos), func(idx int) string {
+		return uncommit(timeout, repos[idx])
+	})
+	var entries []uncommittedEntry
+	for _, res := range all {
 		if res != "" {
 			for _, line := range strings.Split(res, "\n") {
-				results = append(results, fmt.Sprintf("%s%s", prefix, strings.Replace(line, home, "", 1)))
+				entries = append(entries, newUncommittedEntry(strings.Replace(line, home, "", 1)))
 			}
 		}
 	}
-	if len(results) > 0 {
-		if isMessage {
-			fmt.Println("uncommitted\n===")
-		}
-		sort.Strings(results)
-		fmt.Println(strings.Join(results, "\n"))
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].line < entries[j].line
+	})
+	if op == "motd" {
+		return uncommittedNotify(cfg.Settings.Outputs, entries)
+	}
+	if len(entries) > 0 {
+		fmt.Println(uncommittedLines(entries, ""))
 	}
 	return nil
 }
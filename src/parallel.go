@@ -0,0 +1,36 @@
+// Package main handles various utility needs
+package main
+
+type parallelResult[T any] struct {
+	idx   int
+	value T
+}
+
+// Parallel will run fn for each index with a bounded number of workers,
+// results are returned in index order regardless of scheduling
+func Parallel[T any](workers, count int, fn func(int) T) []T {
+	if workers <= 0 {
+		workers = 1
+	}
+	jobs := make(chan int)
+	results := make(chan parallelResult[T])
+	for range min(workers, count) {
+		go func() {
+			for idx := range jobs {
+				results <- parallelResult[T]{idx, fn(idx)}
+			}
+		}()
+	}
+	go func() {
+		for idx := range count {
+			jobs <- idx
+		}
+		close(jobs)
+	}()
+	all := make([]T, count)
+	for range count {
+		r := <-results
+		all[r.idx] = r.value
+	}
+	return all
+}
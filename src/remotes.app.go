@@ -3,125 +3,1495 @@ package main
 
 import (
 	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"flag"
 	"fmt"
+	"io"
+	"net/http"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"regexp"
+	"runtime"
 	"slices"
 	"sort"
+	"strconv"
 	"strings"
+	"text/template"
+	"time"
 )
 
-// RemotesApp helps sync release tags from remotes for update tracking
-func RemotesApp(a Args) error {
-	home := os.Getenv("HOME")
-	type modeType struct {
-		Command   string
-		Arguments []string
+const (
+	remoteSemver  = "semver"
+	remoteCalver  = "calver"
+	remoteTimeout = time.Minute
+	remoteCommand = "command"
+	remoteGit     = "git"
+	remoteJSON    = "json"
+	remoteFeed    = "feed"
+
+	remoteStateVersion = 1
+	remoteDevtools     = "devtools"
+	remoteBuildFrom    = "build-from"
+)
+
+type (
+	remoteMode struct {
+		Type       string
+		URL        string
+		Path       string
+		Command    string
+		Arguments  []string
+		Filter     string
+		Transforms []remoteTransform
+		Channels   []string
+		Scheme     string
+		Timeout    string
+		Retries    int
+		Changelog  remoteChangelog
+	}
+	remoteSettings struct {
+		Sources    map[string]remoteSourceConfig
+		State      string
+		Modes      map[string]remoteMode
+		Prerelease bool
+		Pins       map[string]string
+		Workers    int
+		Report     string
+		Advisories string
+	}
+	remoteChangelog struct {
+		Command []string
+		URL     string
+	}
+	remoteTemplateData struct {
+		Source   string
+		Name     string
+		Version  string
+		Previous string
+	}
+	remoteTransform struct {
+		Type  string
+		Value string
+		With  string
+		re    *regexp.Regexp
+	}
+	remoteFilter struct {
+		re         *regexp.Regexp
+		version    int
+		channel    int
+		channels   []string
+		transforms []remoteTransform
+	}
+	remoteUpgrade struct {
+		Devtools  []string
+		BuildFrom string
+		Recipe    string
+	}
+	remoteSourceConfig struct {
+		Mode      string
+		Alias     string
 		Filter    string
+		Arguments []string
+		Upgrade   remoteUpgrade
+		Package   string
+		EOL       []string
 	}
-	cfg := Configuration[struct {
-		Sources map[string]string
-		State   string
-		Modes   map[string]modeType
-	}]{}
-	if err := cfg.Load(a); err != nil {
+	remoteSource struct {
+		source      string
+		name        string
+		typed       string
+		mode        remoteMode
+		filter      *remoteFilter
+		constraints []remoteConstraint
+		pkg         string
+		eol         [][]remoteConstraint
+	}
+	remoteState struct {
+		Version int
+		Sources map[string]remoteStateEntry
+		History []remoteHistory
+	}
+	remoteStateEntry struct {
+		Source       string
+		Version      string
+		Mode         string
+		FirstSeen    time.Time
+		Acknowledged time.Time
+		Latest       string
+		LatestSeen   time.Time
+		NeedsUpgrade bool
+	}
+	remoteHistory struct {
+		Time   time.Time
+		Mode   string
+		Change remoteChange
+	}
+	remoteChange struct {
+		Name       string
+		Kind       string
+		Added      string
+		Removed    string
+		Advisories []string
+		EOL        bool
+	}
+	remoteFlagged struct {
+		Name       string
+		Version    string
+		Advisories []string
+		EOL        bool
+	}
+	remoteOSV struct {
+		ID       string `json:"id"`
+		Affected []struct {
+			Package struct {
+				Name string `json:"name"`
+			} `json:"package"`
+			Ranges   []remoteOSVRange `json:"ranges"`
+			Versions []string         `json:"versions"`
+		} `json:"affected"`
+	}
+	remoteOSVRange struct {
+		Type   string              `json:"type"`
+		Events []map[string]string `json:"events"`
+	}
+	remoteAdvisories map[string][]remoteOSV
+	remoteFetched    struct {
+		latest remoteVersion
+		err    error
+	}
+	remoteVersion struct {
+		raw   string
+		parts []int
+		pre   []string
+	}
+	remoteConstraint func(remoteVersion) bool
+)
+
+var (
+	remoteSemverRegexp = regexp.MustCompile(`^[vV]?(\d+(?:\.\d+)*)(?:-([0-9A-Za-z.-]+))?(?:\+[0-9A-Za-z.-]+)?$`)
+	remoteCalverRegexp = regexp.MustCompile(`^[vV]?(\d+(?:[._-]\d+)*)$`)
+)
+
+// UnmarshalJSON allows a source to be just a mode name or a full definition
+func (c *remoteSourceConfig) UnmarshalJSON(b []byte) error {
+	var mode string
+	if err := json.Unmarshal(b, &mode); err == nil {
+		c.Mode = mode
+		return nil
+	}
+	type plain remoteSourceConfig
+	return json.Unmarshal(b, (*plain)(c))
+}
+
+// remoteNames gives each source a unique name, an alias, the name it is known by (from state) or the shortest
+// unique path suffix of the source, known names are kept so adding sources never renames existing ones
+func remoteNames(sources map[string]remoteSourceConfig, known map[string]string) (map[string]string, error) {
+	names := make(map[string]string)
+	owners := make(map[string]string)
+	var pending []string
+	for source, def := range sources {
+		if def.Alias == "" {
+			pending = append(pending, source)
+			continue
+		}
+		if other, ok := owners[def.Alias]; ok {
+			return nil, fmt.Errorf("duplicate source alias: %s (%s, %s)", def.Alias, source, other)
+		}
+		owners[def.Alias] = source
+		names[source] = def.Alias
+	}
+	sort.Strings(pending)
+	var unnamed []string
+	for _, source := range pending {
+		name, ok := known[source]
+		if _, taken := owners[name]; ok && !taken {
+			owners[name] = source
+			names[source] = name
+			continue
+		}
+		unnamed = append(unnamed, source)
+	}
+	pending = unnamed
+	parts := func(source string) []string {
+		if _, after, ok := strings.Cut(source, "://"); ok {
+			source = after
+		}
+		return strings.Split(strings.Trim(source, "/"), "/")
+	}
+	candidate := func(source string, depth int) string {
+		p := parts(source)
+		return strings.Join(p[max(0, len(p)-depth):], "/")
+	}
+	for depth := 1; len(pending) > 0; depth++ {
+		counts := make(map[string]int)
+		deepest := true
+		for _, source := range pending {
+			counts[candidate(source, depth)]++
+			if depth < len(parts(source)) {
+				deepest = false
+			}
+		}
+		var next []string
+		for _, source := range pending {
+			name := candidate(source, depth)
+			if _, taken := owners[name]; counts[name] == 1 && !taken {
+				owners[name] = source
+				names[source] = name
+				continue
+			}
+			next = append(next, source)
+		}
+		if deepest && len(next) > 0 {
+			return nil, fmt.Errorf("duplicate source names: %s", strings.Join(next, ", "))
+		}
+		pending = next
+	}
+	return names, nil
+}
+
+func (m remoteMode) timeout() (time.Duration, error) {
+	if m.Timeout == "" {
+		return remoteTimeout, nil
+	}
+	return time.ParseDuration(m.Timeout)
+}
+
+// read gets the raw (line based) output of the mode for a source
+func (m remoteMode) read(ctx context.Context, source string) (string, error) {
+	if m.Type == "" || m.Type == remoteCommand {
+		args := append([]string{}, m.Arguments...)
+		args = append(args, source)
+		cmd := exec.CommandContext(ctx, m.Command, args...)
+		cmd.WaitDelay = time.Second
+		out, err := cmd.Output()
+		if exit, ok := err.(*exec.ExitError); ok {
+			if msg, _, _ := strings.Cut(strings.TrimSpace(string(exit.Stderr)), "\n"); msg != "" {
+				err = fmt.Errorf("%w (%s)", err, msg)
+			}
+		}
+		return string(out), err
+	}
+	url, err := m.url(source)
+	if err != nil {
+		return "", err
+	}
+	var lines []string
+	switch m.Type {
+	case remoteGit:
+		lines, err = remoteGitRefs(ctx, url)
+	case remoteJSON:
+		lines, err = remoteJSONValues(ctx, url, m.Path)
+	case remoteFeed:
+		lines, err = remoteFeedTitles(ctx, url)
+	default:
+		return "", fmt.Errorf("unknown mode type: %s", m.Type)
+	}
+	return strings.Join(lines, "\n"), err
+}
+
+func (m remoteMode) validate() error {
+	switch m.Type {
+	case "", remoteCommand:
+		if m.Command == "" {
+			return errors.New("command required")
+		}
+	case remoteJSON:
+		if m.Path == "" {
+			return errors.New("json path required")
+		}
+		fallthrough
+	case remoteFeed:
+		if m.URL == "" {
+			return errors.New("url required")
+		}
+	case remoteGit:
+	default:
+		return fmt.Errorf("unknown mode type: %s", m.Type)
+	}
+	if m.Changelog.URL != "" && len(m.Changelog.Command) > 0 {
+		return errors.New("changelog can only have a command or url")
+	}
+	if _, err := m.url(""); err != nil {
 		return err
 	}
+	_, err := m.timeout()
+	return err
+}
 
-	state := filepath.Join(home, cfg.Settings.State)
-	var had []string
-	isInit := !PathExists(state)
-	if isInit {
-		fmt.Println("initializing...")
-	} else {
-		last, err := os.ReadFile(state)
+// url builds the provider location for a source, git sources default to https
+func (m remoteMode) url(source string) (string, error) {
+	text := m.URL
+	if text == "" {
+		if strings.Contains(source, "://") {
+			return source, nil
+		}
+		text = "https://{{ .Source }}"
+	}
+	return remoteTemplate(text, remoteTemplateData{Source: source, Name: filepath.Base(source)})
+}
+
+func remoteTemplate(text string, data remoteTemplateData) (string, error) {
+	t, err := template.New("t").Parse(text)
+	if err != nil {
+		return "", err
+	}
+	var buf bytes.Buffer
+	if err := t.Execute(&buf, data); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// fetch gets the changelog for a version using the command or url (templated)
+func (c remoteChangelog) fetch(ctx context.Context, data remoteTemplateData) (string, error) {
+	if c.URL != "" {
+		url, err := remoteTemplate(c.URL, data)
 		if err != nil {
-			return err
+			return "", err
+		}
+		b, err := remoteGet(ctx, url, nil)
+		return strings.TrimSpace(string(b)), err
+	}
+	var args []string
+	for _, arg := range c.Command {
+		a, err := remoteTemplate(arg, data)
+		if err != nil {
+			return "", err
+		}
+		args = append(args, a)
+	}
+	cmd := exec.CommandContext(ctx, args[0], args[1:]...)
+	cmd.WaitDelay = time.Second
+	out, err := cmd.Output()
+	return strings.TrimSpace(string(out)), err
+}
+
+func (c remoteChangelog) enabled() bool {
+	return c.URL != "" || len(c.Command) > 0
+}
+
+func remoteGet(ctx context.Context, url string, headers map[string]string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s: %s", url, resp.Status)
+	}
+	return io.ReadAll(resp.Body)
+}
+
+// remoteGitRefs reads the smart-HTTP ref advertisement, lines match `git ls-remote` output
+func remoteGitRefs(ctx context.Context, url string) ([]string, error) {
+	const service = "git-upload-pack"
+	b, err := remoteGet(ctx, fmt.Sprintf("%s/info/refs?service=%s", strings.TrimSuffix(url, "/"), service), nil)
+	if err != nil {
+		return nil, err
+	}
+	var lines []string
+	for len(b) > 0 {
+		if len(b) < 4 {
+			return nil, errors.New("invalid pkt-line")
+		}
+		size, err := strconv.ParseUint(string(b[:4]), 16, 16)
+		if err != nil {
+			return nil, fmt.Errorf("invalid pkt-line length: %w", err)
+		}
+		if size == 0 {
+			b = b[4:]
+			continue
+		}
+		if size < 4 || int(size) > len(b) {
+			return nil, errors.New("invalid pkt-line length")
+		}
+		line := string(b[4:size])
+		b = b[size:]
+		line, _, _ = strings.Cut(strings.TrimSuffix(line, "\n"), "\x00")
+		if strings.HasPrefix(line, "#") {
+			continue
+		}
+		oid, ref, ok := strings.Cut(line, " ")
+		if !ok {
+			return nil, fmt.Errorf("invalid ref advertisement: %s", line)
+		}
+		lines = append(lines, fmt.Sprintf("%s\t%s", oid, ref))
+	}
+	return lines, nil
+}
+
+// remoteJSONValues gets the values at a path (e.g. "[].tag_name" or "data.releases.[].version")
+func remoteJSONValues(ctx context.Context, url, path string) ([]string, error) {
+	b, err := remoteGet(ctx, url, map[string]string{"Accept": "application/json"})
+	if err != nil {
+		return nil, err
+	}
+	var data any
+	if err := json.Unmarshal(b, &data); err != nil {
+		return nil, err
+	}
+	values := []any{data}
+	for _, key := range strings.Split(path, ".") {
+		var next []any
+		for _, v := range values {
+			switch typed := v.(type) {
+			case []any:
+				if key == "[]" {
+					next = append(next, typed...)
+				}
+			case map[string]any:
+				if child, ok := typed[key]; ok {
+					next = append(next, child)
+				}
+			}
+		}
+		values = next
+	}
+	var lines []string
+	for _, v := range values {
+		switch v.(type) {
+		case string, float64, bool:
+			lines = append(lines, fmt.Sprintf("%v", v))
+		}
+	}
+	return lines, nil
+}
+
+// remoteFeedTitles gets entry titles from an Atom or RSS feed
+func remoteFeedTitles(ctx context.Context, url string) ([]string, error) {
+	b, err := remoteGet(ctx, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	type entry struct {
+		Title string `xml:"title"`
+	}
+	var feed struct {
+		Entries []entry `xml:"entry"`
+		Channel struct {
+			Items []entry `xml:"item"`
+		} `xml:"channel"`
+	}
+	if err := xml.Unmarshal(b, &feed); err != nil {
+		return nil, err
+	}
+	var lines []string
+	for _, e := range append(feed.Entries, feed.Channel.Items...) {
+		if t := strings.TrimSpace(e.Title); t != "" {
+			lines = append(lines, t)
+		}
+	}
+	return lines, nil
+}
+
+// fetch gets the versions for a source, retrying (with backoff) failed commands
+func (r remoteSource) fetch() ([]remoteVersion, error) {
+	lines, err := r.lines()
+	if err != nil {
+		return nil, err
+	}
+	var versions []remoteVersion
+	for _, line := range lines {
+		if raw, ok := r.filter.match(line); ok {
+			if v, ok := parseRemoteVersion(r.mode.Scheme, raw); ok {
+				versions = append(versions, v)
+			}
+		}
+	}
+	return versions, nil
+}
+
+func (r remoteSource) lines() ([]string, error) {
+	timeout, err := r.mode.timeout()
+	if err != nil {
+		return nil, err
+	}
+	var out string
+	for attempt := 0; ; attempt++ {
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		out, err = r.mode.read(ctx, r.source)
+		cancel()
+		if err == nil {
+			break
+		}
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			err = fmt.Errorf("timeout after %s", timeout)
+		}
+		if attempt >= r.mode.Retries {
+			return nil, err
+		}
+		time.Sleep(time.Second << attempt)
+	}
+	var lines []string
+	for _, line := range strings.Split(strings.TrimSpace(out), "\n") {
+		if t := strings.TrimSpace(line); t != "" {
+			lines = append(lines, t)
+		}
+	}
+	return lines, nil
+}
+
+// test shows each line from the source and how the filter handles it
+func (r remoteSource) test() error {
+	lines, err := r.lines()
+	if err != nil {
+		return err
+	}
+	for _, line := range lines {
+		raw, ok := r.filter.match(line)
+		switch {
+		case !ok:
+			fmt.Printf("[-] %s\n", line)
+		default:
+			status := "+"
+			if _, valid := parseRemoteVersion(r.mode.Scheme, raw); !valid {
+				status = "!"
+			}
+			fmt.Printf("[%s] %s => %s\n", status, line, raw)
+		}
+	}
+	return nil
+}
+
+// newRemoteFilter validates the filter has a version (named or first) group and the transforms
+func newRemoteFilter(mode remoteMode) (*remoteFilter, error) {
+	re, err := regexp.Compile(mode.Filter)
+	if err != nil {
+		return nil, err
+	}
+	f := &remoteFilter{re: re, version: 1, channels: mode.Channels, transforms: slices.Clone(mode.Transforms)}
+	if re.NumSubexp() == 0 {
+		return nil, fmt.Errorf("filter has no capture group: %s", mode.Filter)
+	}
+	if idx := re.SubexpIndex("version"); idx > 0 {
+		f.version = idx
+	} else if slices.ContainsFunc(re.SubexpNames(), func(n string) bool { return n != "" }) {
+		return nil, fmt.Errorf("filter with named groups requires a version group: %s", mode.Filter)
+	}
+	f.channel = re.SubexpIndex("channel")
+	if len(f.channels) > 0 && f.channel < 0 {
+		return nil, fmt.Errorf("channels require a channel group: %s", mode.Filter)
+	}
+	for idx, t := range f.transforms {
+		switch t.Type {
+		case "trim-prefix", "trim-suffix", "replace", "lower":
+		case "regexp":
+			if f.transforms[idx].re, err = regexp.Compile(t.Value); err != nil {
+				return nil, err
+			}
+		default:
+			return nil, fmt.Errorf("unknown transform: %s", t.Type)
+		}
+	}
+	return f, nil
+}
+
+// match gets the (transformed) version from a line
+func (f *remoteFilter) match(line string) (string, bool) {
+	matches := f.re.FindStringSubmatch(line)
+	if matches == nil {
+		return "", false
+	}
+	if f.channel > 0 && len(f.channels) > 0 && !slices.Contains(f.channels, matches[f.channel]) {
+		return "", false
+	}
+	version := matches[f.version]
+	for _, t := range f.transforms {
+		switch t.Type {
+		case "trim-prefix":
+			version = strings.TrimPrefix(version, t.Value)
+		case "trim-suffix":
+			version = strings.TrimSuffix(version, t.Value)
+		case "replace":
+			version = strings.ReplaceAll(version, t.Value, t.With)
+		case "lower":
+			version = strings.ToLower(version)
+		case "regexp":
+			version = t.re.ReplaceAllString(version, t.With)
+		}
+	}
+	return version, version != ""
+}
+
+// parseRemoteVersion parses a version given a scheme (semver or calver/date based)
+func parseRemoteVersion(scheme, raw string) (remoteVersion, bool) {
+	v := remoteVersion{raw: raw}
+	var main string
+	switch scheme {
+	case "", remoteSemver:
+		matches := remoteSemverRegexp.FindStringSubmatch(raw)
+		if matches == nil {
+			return v, false
+		}
+		main = matches[1]
+		if matches[2] != "" {
+			v.pre = strings.Split(matches[2], ".")
+		}
+	case remoteCalver:
+		matches := remoteCalverRegexp.FindStringSubmatch(raw)
+		if matches == nil {
+			return v, false
+		}
+		main = matches[1]
+	default:
+		return v, false
+	}
+	for _, p := range strings.FieldsFunc(main, func(r rune) bool {
+		return r == '.' || r == '-' || r == '_'
+	}) {
+		i, err := strconv.Atoi(p)
+		if err != nil {
+			return v, false
+		}
+		v.parts = append(v.parts, i)
+	}
+	return v, true
+}
+
+func (v remoteVersion) stable() bool {
+	return len(v.pre) == 0
+}
+
+// compare follows semver precedence, missing numeric parts are treated as 0
+func (v remoteVersion) compare(other remoteVersion) int {
+	for idx := range max(len(v.parts), len(other.parts)) {
+		var l, r int
+		if idx < len(v.parts) {
+			l = v.parts[idx]
+		}
+		if idx < len(other.parts) {
+			r = other.parts[idx]
+		}
+		if c := l - r; c != 0 {
+			return c
+		}
+	}
+	switch {
+	case v.stable() && other.stable():
+		return 0
+	case v.stable():
+		return 1
+	case other.stable():
+		return -1
+	}
+	for idx := range min(len(v.pre), len(other.pre)) {
+		l, r := v.pre[idx], other.pre[idx]
+		if l == r {
+			continue
+		}
+		ln, lerr := strconv.Atoi(l)
+		rn, rerr := strconv.Atoi(r)
+		switch {
+		case lerr == nil && rerr == nil:
+			return ln - rn
+		case lerr == nil:
+			return -1
+		case rerr == nil:
+			return 1
+		}
+		return strings.Compare(l, r)
+	}
+	return len(v.pre) - len(other.pre)
+}
+
+// classify gives the kind of update going from this version to the other
+func (v remoteVersion) classify(other remoteVersion) string {
+	for idx, kind := range []string{"major", "minor"} {
+		var l, r int
+		if idx < len(v.parts) {
+			l = v.parts[idx]
+		}
+		if idx < len(other.parts) {
+			r = other.parts[idx]
+		}
+		if l != r {
+			return kind
+		}
+	}
+	if slices.Equal(v.parts, other.parts) {
+		return "prerelease"
+	}
+	return "patch"
+}
+
+// parseRemoteConstraints handles ranges such as ">=1.2 <2", "1.4.x", "^1.2" or "~1.2.3"
+func parseRemoteConstraints(scheme, text string) ([]remoteConstraint, error) {
+	var constraints []remoteConstraint
+	for _, field := range strings.FieldsFunc(text, func(r rune) bool {
+		return r == ' ' || r == ','
+	}) {
+		value := strings.TrimLeftFunc(field, func(r rune) bool {
+			return strings.ContainsRune("<>=^~", r)
+		})
+		op := strings.TrimSuffix(field, value)
+		if op == "" && (strings.HasSuffix(value, ".x") || strings.HasSuffix(value, ".*")) {
+			value = value[:len(value)-2]
+		}
+		bound, ok := parseRemoteVersion(scheme, value)
+		if !ok {
+			return nil, fmt.Errorf("invalid version constraint: %s", field)
+		}
+		prefix := func(v remoteVersion, count int) bool {
+			return len(v.parts) >= count && slices.Equal(v.parts[:count], bound.parts[:count])
+		}
+		var check remoteConstraint
+		switch op {
+		case "":
+			check = func(v remoteVersion) bool { return prefix(v, len(bound.parts)) }
+		case "=":
+			check = func(v remoteVersion) bool { return v.compare(bound) == 0 }
+		case ">":
+			check = func(v remoteVersion) bool { return v.compare(bound) > 0 }
+		case ">=":
+			check = func(v remoteVersion) bool { return v.compare(bound) >= 0 }
+		case "<":
+			check = func(v remoteVersion) bool { return v.compare(bound) < 0 }
+		case "<=":
+			check = func(v remoteVersion) bool { return v.compare(bound) <= 0 }
+		case "^":
+			// compatible up to the first non-zero part (^1.2 is 1.x, ^0.2.3 is 0.2.x, ^0.0.3 is only 0.0.3)
+			keep := len(bound.parts)
+			for idx, part := range bound.parts {
+				if part != 0 {
+					keep = idx + 1
+					break
+				}
+			}
+			check = func(v remoteVersion) bool { return v.compare(bound) >= 0 && prefix(v, keep) }
+		case "~":
+			check = func(v remoteVersion) bool { return v.compare(bound) >= 0 && prefix(v, min(2, len(bound.parts))) }
+		default:
+			return nil, fmt.Errorf("invalid version operator: %s", field)
+		}
+		constraints = append(constraints, check)
+	}
+	return constraints, nil
+}
+
+// latestRemoteVersion selects the newest version allowed by the settings
+func latestRemoteVersion(versions []remoteVersion, prerelease bool, constraints []remoteConstraint) (remoteVersion, bool) {
+	var latest remoteVersion
+	found := false
+	for _, v := range versions {
+		if !prerelease && !v.stable() {
+			continue
+		}
+		allowed := true
+		for _, c := range constraints {
+			if !c(v) {
+				allowed = false
+				break
+			}
+		}
+		if !allowed {
+			continue
 		}
-		for _, line := range strings.Split(strings.TrimSpace(string(last)), "\n") {
-			t := strings.TrimSpace(line)
-			if t == "" {
+		if !found || v.compare(latest) > 0 {
+			latest = v
+			found = true
+		}
+	}
+	return latest, found
+}
+
+// readRemoteState reads the state file, migrating the original "name version" text format
+func readRemoteState(path string, schemes, modes map[string]string) (remoteState, error) {
+	state := remoteState{Version: remoteStateVersion, Sources: make(map[string]remoteStateEntry)}
+	if !PathExists(path) {
+		return state, nil
+	}
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return state, err
+	}
+	trimmed := strings.TrimSpace(string(b))
+	if strings.HasPrefix(trimmed, "{") {
+		if err := json.Unmarshal(b, &state); err != nil {
+			return state, err
+		}
+		if state.Version > remoteStateVersion {
+			return state, fmt.Errorf("unsupported state version: %d", state.Version)
+		}
+		if state.Sources == nil {
+			state.Sources = make(map[string]remoteStateEntry)
+		}
+		state.Version = remoteStateVersion
+		return state, nil
+	}
+	for _, line := range strings.Split(trimmed, "\n") {
+		name, version, ok := strings.Cut(strings.TrimSpace(line), " ")
+		if !ok {
+			continue
+		}
+		if prev, ok := state.Sources[name]; ok {
+			// older state files tracked every version seen per source
+			l, lok := parseRemoteVersion(schemes[name], prev.Version)
+			r, rok := parseRemoteVersion(schemes[name], version)
+			if lok && (!rok || l.compare(r) >= 0) {
 				continue
 			}
-			had = append(had, t)
+		}
+		state.Sources[name] = remoteStateEntry{Version: version, Mode: modes[name], Latest: version}
+	}
+	return state, nil
+}
+
+// known gets the names sources are tracked by, entries from before sources were recorded are matched by
+// (unambiguous) path suffix
+func (s remoteState) known(sources map[string]remoteSourceConfig) map[string]string {
+	known := make(map[string]string)
+	for name, entry := range s.Sources {
+		if entry.Source != "" {
+			if _, ok := sources[entry.Source]; ok {
+				known[entry.Source] = name
+			}
+			continue
+		}
+		var matches []string
+		for source := range sources {
+			if source == name || strings.HasSuffix(strings.TrimRight(source, "/"), fmt.Sprintf("/%s", name)) {
+				matches = append(matches, source)
+			}
+		}
+		if len(matches) == 1 {
+			if _, ok := known[matches[0]]; !ok {
+				known[matches[0]] = name
+			}
 		}
 	}
-	var now []string
-	versioner := func(n, v string) {
-		now = append(now, fmt.Sprintf("%s %s", n, v))
+	return known
+}
+
+func (s remoteState) write(path string) error {
+	b, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
 	}
-	filterSet := make(map[string]*regexp.Regexp)
-	for k, v := range cfg.Settings.Modes {
-		r, err := regexp.Compile(v.Filter)
+	return os.WriteFile(path, append(b, '\n'), 0o644)
+}
+
+// history displays acknowledged changes within a number of days (default 30)
+func (s remoteState) history(days string, asJSON bool) error {
+	count := 30
+	if days != "" {
+		var err error
+		count, err = strconv.Atoi(days)
+		if err != nil || count <= 0 {
+			return fmt.Errorf("invalid number of days: %s", days)
+		}
+	}
+	since := time.Now().AddDate(0, 0, -count)
+	var entries []remoteHistory
+	for _, h := range s.History {
+		if h.Time.After(since) {
+			entries = append(entries, h)
+		}
+	}
+	if asJSON {
+		b, err := json.MarshalIndent(entries, "", "  ")
 		if err != nil {
 			return err
 		}
-		filterSet[k] = r
+		fmt.Println(string(b))
+		return nil
+	}
+	for _, h := range entries {
+		c := h.Change
+		detail := c.Added
+		switch c.Kind {
+		case "removed":
+			detail = c.Removed
+		case "new":
+		default:
+			detail = fmt.Sprintf("%s -> %s", c.Removed, c.Added)
+		}
+		fmt.Printf("%s %s %s (%s)\n", h.Time.Format(time.DateOnly), c.Name, detail, c.Kind)
+	}
+	return nil
+}
+
+// upgrade runs the install action for sources with acknowledged (but not yet upgraded) updates
+func (s remoteState) upgrade(path, home string, sources map[string]remoteSourceConfig, names map[string]string, only []string) error {
+	var keys []string
+	for source := range sources {
+		keys = append(keys, source)
+	}
+	sort.Strings(keys)
+	for _, name := range only {
+		if _, ok := s.Sources[name]; !ok {
+			return fmt.Errorf("unknown source to upgrade: %s", name)
+		}
+	}
+	var errs []error
+	upgraded := false
+	for _, source := range keys {
+		def := sources[source]
+		name := names[source]
+		if !def.Upgrade.enabled() || (len(only) > 0 && !slices.Contains(only, name)) {
+			continue
+		}
+		entry, ok := s.Sources[name]
+		if !ok || !entry.NeedsUpgrade {
+			continue
+		}
+		fmt.Printf("upgrading: %s %s\n", name, entry.Version)
+		if err := def.Upgrade.run(home); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", name, err))
+			continue
+		}
+		entry.NeedsUpgrade = false
+		s.Sources[name] = entry
+		upgraded = true
+	}
+	if upgraded {
+		if err := s.write(path); err != nil {
+			return err
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (u remoteUpgrade) enabled() bool {
+	return len(u.Devtools) > 0 || u.BuildFrom != ""
+}
+
+// run calls devtools (for specific packages) and/or build-from (in a directory)
+func (u remoteUpgrade) run(home string) error {
+	var cmds []*exec.Cmd
+	if len(u.Devtools) > 0 {
+		cmds = append(cmds, exec.Command(remoteDevtools, u.Devtools...))
+	}
+	if u.BuildFrom != "" {
+		var args []string
+		if u.Recipe != "" {
+			args = append(args, u.Recipe)
+		}
+		cmd := exec.Command(remoteBuildFrom, args...)
+		cmd.Dir = filepath.Join(home, u.BuildFrom)
+		cmds = append(cmds, cmd)
+	}
+	for _, cmd := range cmds {
+		cmd.Stdout = os.Stdout
+		cmd.Stderr = os.Stderr
+		if err := cmd.Run(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// loadRemoteAdvisories reads OSV advisories from a file or a directory of json files
+func loadRemoteAdvisories(home, path string) (remoteAdvisories, error) {
+	advisories := make(remoteAdvisories)
+	if path == "" {
+		return advisories, nil
+	}
+	path = filepath.Join(home, path)
+	files := []string{path}
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if info.IsDir() {
+		files, err = filepath.Glob(filepath.Join(path, "*.json"))
+		if err != nil {
+			return nil, err
+		}
+	}
+	for _, file := range files {
+		b, err := os.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		var entries []remoteOSV
+		if strings.HasPrefix(strings.TrimSpace(string(b)), "[") {
+			err = json.Unmarshal(b, &entries)
+		} else {
+			var entry remoteOSV
+			err = json.Unmarshal(b, &entry)
+			entries = append(entries, entry)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%w (%s)", err, file)
+		}
+		for _, entry := range entries {
+			for _, affected := range entry.Affected {
+				name := affected.Package.Name
+				advisories[name] = append(advisories[name], entry)
+			}
+		}
+	}
+	return advisories, nil
+}
+
+// annotate gives the advisories affecting a version and whether it is end-of-life
+func (r remoteSource) annotate(advisories remoteAdvisories, raw string) ([]string, bool) {
+	v, ok := parseRemoteVersion(r.mode.Scheme, raw)
+	if !ok {
+		return nil, false
+	}
+	eol := false
+	for _, constraints := range r.eol {
+		if _, ok := latestRemoteVersion([]remoteVersion{v}, true, constraints); ok {
+			eol = true
+			break
+		}
+	}
+	var ids []string
+	for _, advisory := range advisories[r.pkg] {
+		for _, affected := range advisory.Affected {
+			if affected.Package.Name == r.pkg && remoteAffected(r.mode.Scheme, v, affected.Versions, affected.Ranges) {
+				ids = append(ids, advisory.ID)
+				break
+			}
+		}
+	}
+	sort.Strings(ids)
+	return slices.Compact(ids), eol
+}
+
+// remoteAffected checks the explicit versions and the SEMVER/ECOSYSTEM ranges of an OSV entry
+func remoteAffected(scheme string, v remoteVersion, versions []string, ranges []remoteOSVRange) bool {
+	for _, version := range versions {
+		if other, ok := parseRemoteVersion(scheme, version); ok && other.compare(v) == 0 {
+			return true
+		}
+	}
+	for _, r := range ranges {
+		if r.Type != "SEMVER" && r.Type != "ECOSYSTEM" {
+			continue
+		}
+		affected := false
+		for _, event := range r.Events {
+			for kind, value := range event {
+				bound, ok := parseRemoteVersion(scheme, value)
+				if !ok {
+					continue
+				}
+				switch kind {
+				case "introduced":
+					if v.compare(bound) >= 0 {
+						affected = true
+					}
+				case "fixed":
+					if affected && v.compare(bound) >= 0 {
+						affected = false
+					}
+				case "last_affected":
+					if affected && v.compare(bound) > 0 {
+						affected = false
+					}
+				}
+			}
+		}
+		if affected {
+			return true
+		}
+	}
+	return false
+}
+
+func remoteNotice(advisories []string, eol bool) string {
+	notes := advisories
+	if eol {
+		notes = append(slices.Clone(notes), "eol")
+	}
+	if len(notes) == 0 {
+		return ""
+	}
+	return fmt.Sprintf(" [%s]", strings.Join(notes, ", "))
+}
+
+// RemotesApp helps sync release tags from remotes for update tracking
+func RemotesApp(a Args) error {
+	yes := flag.Bool("yes", false, "apply updates without prompting")
+	no := flag.Bool("no", false, "do not apply updates (no prompt)")
+	check := flag.Bool("check", false, "exit with an error if updates exist (no prompt, state is not written)")
+	asJSON := flag.Bool("json", false, "report changes as json (no prompt, as -no unless -yes or -ack)")
+	ack := flag.String("ack", "", "acknowledge updates only for these (comma separated) sources")
+	flag.Parse()
+	set := 0
+	for _, b := range []bool{*yes, *no, *check, *ack != ""} {
+		if b {
+			set++
+		}
 	}
-	for source, typed := range cfg.Settings.Sources {
+	if set > 1 {
+		return errors.New("only one of -yes, -no, -check and -ack may be used")
+	}
+	home := os.Getenv("HOME")
+	cfg := Configuration[remoteSettings]{}
+	if err := cfg.Load(a); err != nil {
+		return err
+	}
+
+	sourceNames, err := remoteNames(cfg.Settings.Sources, nil)
+	if err != nil {
+		return err
+	}
+	schemes := make(map[string]string)
+	modes := make(map[string]string)
+	index := func() {
+		clear(schemes)
+		clear(modes)
+		for source, def := range cfg.Settings.Sources {
+			name := sourceNames[source]
+			schemes[name] = cfg.Settings.Modes[def.Mode].Scheme
+			modes[name] = def.Mode
+		}
+	}
+	index()
+	statePath := filepath.Join(home, cfg.Settings.State)
+	isInit := !PathExists(statePath)
+	state, err := readRemoteState(statePath, schemes, modes)
+	if err != nil {
+		return err
+	}
+	if sourceNames, err = remoteNames(cfg.Settings.Sources, state.known(cfg.Settings.Sources)); err != nil {
+		return err
+	}
+	index()
+	switch flag.Arg(0) {
+	case "history":
+		return state.history(flag.Arg(1), *asJSON)
+	case "upgrade":
+		return state.upgrade(statePath, home, cfg.Settings.Sources, sourceNames, flag.Args()[1:])
+	}
+	had := make(map[string]string)
+	for name, entry := range state.Sources {
+		if entry.Version != "" {
+			had[name] = entry.Version
+		}
+	}
+	for k, v := range cfg.Settings.Modes {
+		if err := v.validate(); err != nil {
+			return fmt.Errorf("%w (%s)", err, k)
+		}
+	}
+	var sources []remoteSource
+	for source, def := range cfg.Settings.Sources {
+		typed := def.Mode
 		cmd, ok := cfg.Settings.Modes[typed]
 		if !ok {
 			return fmt.Errorf("unknown source mode type: %s (%s)", typed, source)
 		}
-		fmt.Printf("getting: %s\n", source)
-		exe := cmd.Command
-		args := cmd.Arguments
-		args = append(args, source)
-		out, err := exec.Command(exe, args...).Output()
-		if err != nil {
-			return err
+		if def.Filter != "" {
+			cmd.Filter = def.Filter
+		}
+		if def.Arguments != nil {
+			cmd.Arguments = def.Arguments
 		}
 		if len(cmd.Filter) == 0 {
 			return fmt.Errorf("no filters for: %s", source)
 		}
-		name := filepath.Base(source)
-		for _, line := range strings.Split(strings.TrimSpace(string(out)), "\n") {
-			t := strings.TrimSpace(line)
-			if t == "" {
-				continue
+		filter, err := newRemoteFilter(cmd)
+		if err != nil {
+			return fmt.Errorf("%w (%s)", err, source)
+		}
+		name := sourceNames[source]
+		constraints, err := parseRemoteConstraints(cmd.Scheme, cfg.Settings.Pins[name])
+		if err != nil {
+			return fmt.Errorf("%w (%s)", err, source)
+		}
+		pkg := def.Package
+		if pkg == "" {
+			pkg = source
+		}
+		var eol [][]remoteConstraint
+		for _, r := range def.EOL {
+			c, err := parseRemoteConstraints(cmd.Scheme, r)
+			if err != nil {
+				return fmt.Errorf("%w (%s)", err, source)
 			}
-			filter, ok := filterSet[typed]
-			if !ok {
-				return fmt.Errorf("no filters for type: %s", typed)
+			eol = append(eol, c)
+		}
+		sources = append(sources, remoteSource{source, name, typed, cmd, filter, constraints, pkg, eol})
+	}
+	sort.Slice(sources, func(i, j int) bool {
+		return sources[i].source < sources[j].source
+	})
+	if flag.Arg(0) == "test-filter" {
+		for _, src := range sources {
+			if src.source == flag.Arg(1) || src.name == flag.Arg(1) {
+				return src.test()
 			}
-			matches := filter.FindStringSubmatch(line)
-			if len(matches) > 0 {
-				versioner(name, matches[1])
+		}
+		return fmt.Errorf("unknown source: %s", flag.Arg(1))
+	}
+	if isInit && !*asJSON {
+		fmt.Println("initializing...")
+	}
+	workers := cfg.Settings.Workers
+	if workers <= 0 {
+		workers = runtime.NumCPU()
+	}
+	fetched := Parallel(workers, len(sources), func(idx int) remoteFetched {
+		src := sources[idx]
+		if !*asJSON {
+			fmt.Printf("getting: %s\n", src.source)
+		}
+		versions, err := src.fetch()
+		if err != nil {
+			return remoteFetched{err: err}
+		}
+		latest, ok := latestRemoteVersion(versions, cfg.Settings.Prerelease, src.constraints)
+		if !ok {
+			return remoteFetched{err: errors.New("no versions found")}
+		}
+		return remoteFetched{latest: latest}
+	})
+	now := make(map[string]remoteVersion)
+	failed := make(map[string]error)
+	for idx, res := range fetched {
+		name := sources[idx].name
+		if res.err != nil {
+			failed[sources[idx].source] = res.err
+			if prev, ok := had[name]; ok {
+				// keep what was known, a failed fetch is not a removal
+				now[name] = remoteVersion{raw: prev}
 			}
+			continue
+		}
+		now[name] = res.latest
+	}
+	timestamp := time.Now()
+	dirty := false
+	for _, src := range sources {
+		curr, ok := now[src.name]
+		if !ok || failed[src.source] != nil {
+			continue
+		}
+		entry := state.Sources[src.name]
+		if entry.Source != src.source {
+			entry.Source = src.source
+			state.Sources[src.name] = entry
+			dirty = true
+		}
+		if entry.Latest != curr.raw {
+			entry.Latest = curr.raw
+			entry.LatestSeen = timestamp
+			entry.Mode = src.typed
+			state.Sources[src.name] = entry
+			dirty = true
 		}
 	}
 
-	sort.Strings(now)
-	if len(had) > 0 || isInit {
-		differ := func(prefix rune, left, right []string) bool {
-			status := false
-			for _, item := range left {
-				if slices.Contains(right, item) {
-					continue
+	var names []string
+	for name := range had {
+		names = append(names, name)
+	}
+	for name := range now {
+		if _, ok := had[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	var changes []remoteChange
+	for _, name := range names {
+		prev, wasTracked := had[name]
+		curr, isTracked := now[name]
+		change := remoteChange{Name: name, Removed: prev, Added: curr.raw}
+		switch {
+		case !isTracked:
+			change.Kind = "removed"
+		case !wasTracked:
+			change.Kind = "new"
+		case prev != curr.raw:
+			change.Kind = "changed"
+			if old, ok := parseRemoteVersion(schemes[name], prev); ok {
+				change.Kind = old.classify(curr)
+				if old.compare(curr) > 0 {
+					change.Kind = "downgrade"
 				}
-				fmt.Printf("%c %s\n", prefix, item)
-				status = true
 			}
-			return status
+		default:
+			continue
 		}
-
-		older := differ('-', had, now)
-		newer := differ('+', now, had)
-		if older || newer || isInit {
-			fmt.Printf("updates applied? (y/N) ")
-			reader := bufio.NewReader(os.Stdin)
-			line, err := reader.ReadString('\n')
-			if err != nil {
-				return err
+		changes = append(changes, change)
+	}
+	var errs []error
+	if len(failed) > 0 {
+		errs = append(errs, fmt.Errorf("unable to get %d sources", len(failed)))
+	}
+	bySource := make(map[string]remoteSource)
+	for _, src := range sources {
+		bySource[src.name] = src
+	}
+	advisories, err := loadRemoteAdvisories(home, cfg.Settings.Advisories)
+	if err != nil {
+		return err
+	}
+	for idx, c := range changes {
+		if src, ok := bySource[c.Name]; ok && c.Kind != "removed" {
+			changes[idx].Advisories, changes[idx].EOL = src.annotate(advisories, c.Added)
+		}
+	}
+	var flagged []remoteFlagged
+	for _, src := range sources {
+		version, ok := had[src.name]
+		if !ok {
+			continue
+		}
+		ids, eol := src.annotate(advisories, version)
+		if len(ids) > 0 || eol {
+			flagged = append(flagged, remoteFlagged{src.name, version, ids, eol})
+		}
+	}
+	changelogs := make(map[string]string)
+	for idx, text := range Parallel(workers, len(changes), func(idx int) string {
+		c := changes[idx]
+		src, ok := bySource[c.Name]
+		if !ok || c.Kind == "removed" || !src.mode.Changelog.enabled() {
+			return ""
+		}
+		timeout, _ := src.mode.timeout()
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		defer cancel()
+		text, err := src.mode.Changelog.fetch(ctx, remoteTemplateData{src.source, filepath.Base(src.source), c.Added, c.Removed})
+		if err != nil {
+			return fmt.Sprintf("unable to get changelog: %v", err)
+		}
+		return text
+	}) {
+		if text != "" {
+			changelogs[changes[idx].Name] = text
+		}
+	}
+	if *asJSON {
+		report := struct {
+			Changes    []remoteChange
+			Flagged    []remoteFlagged
+			Changelogs map[string]string
+			Failed     map[string]string
+		}{changes, flagged, changelogs, make(map[string]string)}
+		for k, v := range failed {
+			report.Failed[k] = v.Error()
+		}
+		b, err := json.MarshalIndent(report, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(b))
+	} else {
+		var diff []string
+		var notes []string
+		for _, c := range changes {
+			notice := remoteNotice(c.Advisories, c.EOL)
+			switch c.Kind {
+			case "removed":
+				diff = append(diff, fmt.Sprintf("- %s %s", c.Name, c.Removed))
+			case "new":
+				diff = append(diff, fmt.Sprintf("+ %s %s%s", c.Name, c.Added, notice))
+			default:
+				diff = append(diff, fmt.Sprintf("+ %s %s -> %s (%s)%s", c.Name, c.Removed, c.Added, c.Kind, notice))
+			}
+			if text, ok := changelogs[c.Name]; ok {
+				notes = append(notes, fmt.Sprintf("\n%s %s\n===\n%s", c.Name, c.Added, text))
 			}
-			switch strings.ToLower(strings.TrimSpace(line)) {
-			case "y":
-				return os.WriteFile(state, []byte(strings.Join(now, "\n")), 0o644)
+		}
+		for _, f := range flagged {
+			diff = append(diff, fmt.Sprintf("! %s %s%s", f.Name, f.Version, remoteNotice(f.Advisories, f.EOL)))
+		}
+		if len(diff) > 0 {
+			fmt.Println(strings.Join(diff, "\n"))
+		}
+		if len(notes) > 0 {
+			if cfg.Settings.Report == "" {
+				fmt.Println(strings.Join(notes, "\n"))
+			} else {
+				report := filepath.Join(home, cfg.Settings.Report)
+				text := strings.Join(append(diff, notes...), "\n")
+				if err := os.WriteFile(report, []byte(text+"\n"), 0o644); err != nil {
+					return err
+				}
+				fmt.Printf("\nchangelogs: %s\n", report)
+			}
+		}
+		if len(failed) > 0 {
+			var keys []string
+			for k := range failed {
+				keys = append(keys, k)
+			}
+			sort.Strings(keys)
+			fmt.Fprintln(os.Stderr, "\nfailed\n===")
+			for _, k := range keys {
+				fmt.Fprintf(os.Stderr, "  %s: %v\n", k, failed[k])
 			}
 		}
 	}
+	save := func() error {
+		// checks are read-only
+		if !*check {
+			if err := state.write(statePath); err != nil {
+				return err
+			}
+		}
+		return errors.Join(errs...)
+	}
+	if len(changes) == 0 && !isInit {
+		if dirty {
+			return save()
+		}
+		return errors.Join(errs...)
+	}
 
-	return nil
+	accept := make(map[string]bool)
+	switch {
+	case *ack != "":
+		for _, name := range strings.Split(*ack, ",") {
+			if !slices.Contains(names, name) {
+				return fmt.Errorf("unknown source to acknowledge: %s", name)
+			}
+			accept[name] = true
+		}
+	case *check:
+		errs = append(errs, errors.New("updates available"))
+		return save()
+	case *no, *asJSON && !*yes:
+		return save()
+	case *yes:
+	default:
+		fmt.Printf("updates applied? (y/N) ")
+		reader := bufio.NewReader(os.Stdin)
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return err
+		}
+		if strings.ToLower(strings.TrimSpace(line)) != "y" {
+			return save()
+		}
+	}
+	for _, c := range changes {
+		if len(accept) > 0 && !accept[c.Name] {
+			continue
+		}
+		state.History = append(state.History, remoteHistory{Time: timestamp, Mode: modes[c.Name], Change: c})
+		if c.Kind == "removed" {
+			delete(state.Sources, c.Name)
+			continue
+		}
+		entry := state.Sources[c.Name]
+		entry.Version = c.Added
+		entry.Mode = modes[c.Name]
+		entry.FirstSeen = entry.LatestSeen
+		entry.Acknowledged = timestamp
+		// only version updates need an upgrade (not newly tracked sources or downgrades)
+		if c.Kind != "new" && c.Kind != "downgrade" {
+			entry.NeedsUpgrade = true
+		}
+		state.Sources[c.Name] = entry
+	}
+	return save()
 }
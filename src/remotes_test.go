@@ -0,0 +1,185 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func remoteTestServer(t *testing.T, path, contentType, body string) string {
+	t.Helper()
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.RequestURI() != path {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", contentType)
+		fmt.Fprint(w, body)
+	}))
+	t.Cleanup(s.Close)
+	return s.URL
+}
+
+func remotePktLine(text string) string {
+	return fmt.Sprintf("%04x%s", len(text)+4, text)
+}
+
+func TestRemoteGitRefs(t *testing.T) {
+	const (
+		head = "1111111111111111111111111111111111111111"
+		tag  = "2222222222222222222222222222222222222222"
+		peel = "3333333333333333333333333333333333333333"
+	)
+	body := remotePktLine("# service=git-upload-pack\n") +
+		"0000" +
+		remotePktLine(head+" HEAD\x00multi_ack side-band-64k symref=HEAD:refs/heads/main\n") +
+		remotePktLine(head+" refs/heads/main\n") +
+		remotePktLine(tag+" refs/tags/v1.2.0\n") +
+		remotePktLine(peel+" refs/tags/v1.2.0^{}") +
+		"0000"
+	url := remoteTestServer(t, "/repo.git/info/refs?service=git-upload-pack", "application/x-git-upload-pack-advertisement", body)
+	lines, err := remoteGitRefs(context.Background(), url+"/repo.git/")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expect := []string{
+		head + "\tHEAD",
+		head + "\trefs/heads/main",
+		tag + "\trefs/tags/v1.2.0",
+		peel + "\trefs/tags/v1.2.0^{}",
+	}
+	if !slices.Equal(lines, expect) {
+		t.Errorf("invalid refs: %v", lines)
+	}
+}
+
+func TestRemoteGitRefsInvalid(t *testing.T) {
+	for name, body := range map[string]string{
+		"length":    "zzzz",
+		"short":     "00",
+		"overflow":  "00ffabc",
+		"too small": "0002",
+		"no ref":    remotePktLine("noref\n"),
+	} {
+		url := remoteTestServer(t, "/info/refs?service=git-upload-pack", "text/plain", body)
+		if _, err := remoteGitRefs(context.Background(), url); err == nil {
+			t.Errorf("%s: error expected", name)
+		}
+	}
+	url := remoteTestServer(t, "/other", "text/plain", "")
+	if _, err := remoteGitRefs(context.Background(), url); err == nil || !strings.Contains(err.Error(), "404") {
+		t.Errorf("status error expected: %v", err)
+	}
+}
+
+func TestRemoteJSONValues(t *testing.T) {
+	body := `{
+  "data": {
+    "releases": [
+      {"version": "1.0.0", "stable": true},
+      {"version": 2},
+      {"version": {"nested": "x"}},
+      {"other": "3.0.0"}
+    ]
+  },
+  "name": "tool"
+}`
+	url := remoteTestServer(t, "/releases", "application/json", body)
+	for path, expect := range map[string][]string{
+		"data.releases.[].version": {"1.0.0", "2"},
+		"data.releases.[].stable":  {"true"},
+		"name":                     {"tool"},
+		"data.releases":            nil,
+		"missing.[].version":       nil,
+		"name.[]":                  nil,
+	} {
+		lines, err := remoteJSONValues(context.Background(), url+"/releases", path)
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", path, err)
+		}
+		if !slices.Equal(lines, expect) {
+			t.Errorf("%s: invalid values: %v", path, lines)
+		}
+	}
+	url = remoteTestServer(t, "/tags", "application/json", `[{"tag_name": "v1"}, {"tag_name": "v2"}]`)
+	lines, err := remoteJSONValues(context.Background(), url+"/tags", "[].tag_name")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !slices.Equal(lines, []string{"v1", "v2"}) {
+		t.Errorf("invalid values: %v", lines)
+	}
+	url = remoteTestServer(t, "/bad", "application/json", "{")
+	if _, err := remoteJSONValues(context.Background(), url+"/bad", "name"); err == nil {
+		t.Error("error expected")
+	}
+}
+
+func TestRemoteFeedTitles(t *testing.T) {
+	atom := `<?xml version="1.0" encoding="UTF-8"?>
+<feed xmlns="http://www.w3.org/2005/Atom">
+  <title>Releases</title>
+  <entry><title>v1.1.0</title></entry>
+  <entry><title>
+    v1.0.0
+  </title></entry>
+  <entry><title></title></entry>
+</feed>`
+	rss := `<?xml version="1.0"?>
+<rss version="2.0">
+  <channel>
+    <title>Releases</title>
+    <item><title>2024.10</title></item>
+    <item><title>2024.09</title></item>
+  </channel>
+</rss>`
+	for name, data := range map[string]struct {
+		body   string
+		expect []string
+	}{
+		"atom": {atom, []string{"v1.1.0", "v1.0.0"}},
+		"rss":  {rss, []string{"2024.10", "2024.09"}},
+	} {
+		url := remoteTestServer(t, "/feed", "application/xml", data.body)
+		lines, err := remoteFeedTitles(context.Background(), url+"/feed")
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", name, err)
+		}
+		if !slices.Equal(lines, data.expect) {
+			t.Errorf("%s: invalid titles: %v", name, lines)
+		}
+	}
+	url := remoteTestServer(t, "/feed", "application/xml", "<feed>")
+	if _, err := remoteFeedTitles(context.Background(), url+"/feed"); err == nil {
+		t.Error("error expected")
+	}
+}
+
+func TestParseRemoteConstraintsCaret(t *testing.T) {
+	for constraint, versions := range map[string]map[string]bool{
+		"^1.2":   {"1.2.0": true, "1.9.3": true, "2.0.0": false, "1.1.9": false},
+		"^0.2.3": {"0.2.3": true, "0.2.9": true, "0.3.0": false, "0.9.0": false, "0.2.2": false},
+		"^0.4":   {"0.4.0": true, "0.4.7": true, "0.5.0": false},
+		"^0.0.3": {"0.0.3": true, "0.0.4": false, "0.1.0": false},
+		"^0.0":   {"0.0.1": true, "0.0.9": true, "0.1.0": false},
+		"^0":     {"0.0.1": true, "0.9.0": true, "1.0.0": false},
+	} {
+		constraints, err := parseRemoteConstraints(remoteSemver, constraint)
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", constraint, err)
+		}
+		for raw, expect := range versions {
+			v, ok := parseRemoteVersion(remoteSemver, raw)
+			if !ok {
+				t.Fatalf("invalid version: %s", raw)
+			}
+			if constraints[0](v) != expect {
+				t.Errorf("%s: %s expected %v", constraint, raw, expect)
+			}
+		}
+	}
+}
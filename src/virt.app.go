@@ -2,68 +2,2086 @@
 package main
 
 import (
+	"bufio"
+	"bytes"
+	"crypto/rand"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
+	"math"
+	"net"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"runtime"
 	"slices"
+	"strconv"
 	"strings"
+	"syscall"
+	"text/template"
+	"time"
 )
 
-// VirtApp handles wrapping vfu with virt helpers
+const (
+	virtJSON          = ".json"
+	virtScreenName    = "vfu-virt-%s"
+	virtRuntime       = ".cache/virt"
+	virtStopTimeout   = 30 * time.Second
+	virtScreen        = "screen"
+	virtTmux          = "tmux"
+	virtNative        = "native"
+	virtSupervise     = "supervise"
+	virtRestartNever  = "no"
+	virtRestartFailed = "on-failure"
+	virtRestartAlways = "always"
+	virtRestartLimit  = 5
+	virtReadyTimeout  = 2 * time.Minute
+	virtStartGrace    = 10 * time.Second
+	virtVFU           = "vfu"
+	virtQEMU          = "qemu"
+	virtSSHForward    = "ssh"
+	virtSSHConfig     = ".ssh/virt.config"
+	virtSnapshots     = ".snapshots"
+	virtSnapshotMeta  = "snapshot.json"
+	virtSnapshotKeep  = 5
+	// virtTicks is the kernel USER_HZ used by /proc times
+	virtTicks = 100
+	// virtDefaultTemplate is used to create machines when no template is given
+	virtDefaultTemplate = `{
+  "Engine": "qemu",
+  "CPUs": 2,
+  "Memory": "2G",
+  "Disks": [
+    {"Path": "{{ $.Name }}.qcow2"}
+  ],
+  "Network": [
+    {"Type": "user", "MAC": "{{ $.MAC }}"}
+  ],
+  "CloudInit": "{{ $.Name }}-seed.iso"
+}
+`
+)
+
+type (
+	virtSettings struct {
+		Directory    string
+		Templates    string
+		Executable   string
+		Runtime      string
+		StopTimeout  string
+		SnapshotKeep int
+		SSHConfig    string
+		virtBackendSettings
+		Machines map[string]virtBackendSettings
+		Engines  map[string]string
+	}
+	virtBackendSettings struct {
+		Engine       string
+		Backend      string
+		Restart      string
+		RestartLimit int
+	}
+	virtContext struct {
+		settings  virtSettings
+		dir       string
+		run       string
+		templates string
+		machines  []string
+	}
+	// virtBackend runs a machine in a session, the hypervisor pid must be written to the pidfile
+	virtBackend interface {
+		start(v virtContext, machine string, command []string) error
+		attach(v virtContext, machine string) error
+	}
+	virtScreenBackend struct{}
+	virtTmuxBackend   struct{}
+	virtNativeBackend struct{}
+	// virtEngine converts a machine definition into the hypervisor invocation
+	virtEngine interface {
+		command(v virtContext, machine, executable string) ([]string, error)
+	}
+	virtVFUEngine  struct{}
+	virtQEMUEngine struct{}
+	// virtPlan is how a machine is orchestrated with other machines
+	virtPlan struct {
+		Autostart bool       `json:",omitempty"`
+		Groups    []string   `json:",omitempty"`
+		Depends   []string   `json:",omitempty"`
+		Ready     *virtProbe `json:",omitempty"`
+	}
+	virtProbe struct {
+		Address string `json:",omitempty"`
+		Command string `json:",omitempty"`
+		Timeout string `json:",omitempty"`
+	}
+	// virtAccess is how a machine is reached from the host
+	virtAccess struct {
+		Forwards []virtForward `json:",omitempty"`
+		SSH      *virtSSH      `json:",omitempty"`
+	}
+	virtForward struct {
+		Name     string `json:",omitempty"`
+		Protocol string `json:",omitempty"`
+		Address  string `json:",omitempty"`
+		Host     int    `json:",omitempty"`
+		Guest    int    `json:",omitempty"`
+	}
+	virtSSH struct {
+		User         string `json:",omitempty"`
+		Forward      string `json:",omitempty"`
+		Host         string `json:",omitempty"`
+		Port         int    `json:",omitempty"`
+		IdentityFile string `json:",omitempty"`
+	}
+	// virtMachine is the common (engine agnostic) machine description
+	virtMachine struct {
+		virtPlan
+		virtAccess
+		Engine    string        `json:",omitempty"`
+		CPUs      int           `json:",omitempty"`
+		Memory    string        `json:",omitempty"`
+		Disks     []virtDisk    `json:",omitempty"`
+		Network   []virtNetwork `json:",omitempty"`
+		CloudInit string        `json:",omitempty"`
+		Arguments []string      `json:",omitempty"`
+	}
+	virtDisk struct {
+		Path     string `json:",omitempty"`
+		Format   string `json:",omitempty"`
+		ReadOnly bool   `json:",omitempty"`
+	}
+	virtNetwork struct {
+		Type   string `json:",omitempty"`
+		MAC    string `json:",omitempty"`
+		Bridge string `json:",omitempty"`
+		Tap    string `json:",omitempty"`
+	}
+	// virtSnapshot is the snapshot metadata (stored with each snapshot disk copy)
+	virtSnapshot struct {
+		Label   string
+		Machine string
+		Created time.Time
+		Disks   []virtSnapshotDisk
+	}
+	virtSnapshotDisk struct {
+		Path string
+		Copy string
+		Size int64
+	}
+	// virtStatus is a machine status (resource usage is only available on linux)
+	virtStatus struct {
+		Name    string
+		State   string
+		Engine  string
+		Backend string
+		PID     int
+		Uptime  int64
+		CPU     float64
+		RSS     int64
+		CPUs    int
+		Memory  string
+	}
+	// virtSample is process cpu usage at a point in time
+	virtSample struct {
+		ticks int64
+		at    time.Time
+	}
+)
+
+// virtPidWrapper records the pid (and start time) and then becomes the executable (same pid and start time)
+var virtPidWrapper = []string{"sh", "-c", `printf '%s\n%s\n' "$$" "$(ps -o lstart= -p $$)" > "$0"; exec "$@"`}
+
+// command for vfu passes the machine file as-is (it is a vfu config)
+func (virtVFUEngine) command(v virtContext, machine, executable string) ([]string, error) {
+	return []string{executable, "--config", v.machineFile(machine)}, nil
+}
+
+func (virtQEMUEngine) command(v virtContext, machine, executable string) ([]string, error) {
+	m, err := v.definition(machine)
+	if err != nil {
+		return nil, err
+	}
+	args := []string{executable, "-name", machine, "-nographic"}
+	kvm := runtime.GOOS == "linux" && PathExists("/dev/kvm")
+	board := "q35"
+	if runtime.GOARCH == "arm64" {
+		board = "virt"
+	}
+	if kvm {
+		args = append(args, "-machine", fmt.Sprintf("%s,accel=kvm", board), "-cpu", "host")
+	} else {
+		args = append(args, "-machine", board)
+	}
+	if m.CPUs > 0 {
+		args = append(args, "-smp", strconv.Itoa(m.CPUs))
+	}
+	if m.Memory != "" {
+		args = append(args, "-m", m.Memory)
+	}
+	for idx, disk := range m.Disks {
+		if disk.Path == "" {
+			return nil, fmt.Errorf("disk %d has no path: %s", idx, machine)
+		}
+		format := disk.Format
+		if format == "" {
+			format = "qcow2"
+		}
+		drive := fmt.Sprintf("file=%s,format=%s,if=virtio", virtQEMUPath(v.resolve(disk.Path)), format)
+		if disk.ReadOnly {
+			drive = fmt.Sprintf("%s,readonly=on", drive)
+		}
+		args = append(args, "-drive", drive)
+	}
+	forwarded := false
+	for idx, network := range m.Network {
+		id := fmt.Sprintf("net%d", idx)
+		var netdev string
+		switch network.Type {
+		case "", "user":
+			netdev = fmt.Sprintf("user,id=%s", id)
+			// forwards are on the first user network
+			if !forwarded {
+				for _, f := range m.Forwards {
+					host, _, err := net.SplitHostPort(f.address())
+					if err != nil {
+						return nil, err
+					}
+					netdev = fmt.Sprintf("%s,hostfwd=%s:%s:%d-:%d", netdev, f.protocol(), host, f.Host, f.Guest)
+				}
+				forwarded = true
+			}
+		case "bridge":
+			if network.Bridge == "" {
+				return nil, fmt.Errorf("bridge network requires bridge: %s", machine)
+			}
+			netdev = fmt.Sprintf("bridge,id=%s,br=%s", id, network.Bridge)
+		case "tap":
+			if network.Tap == "" {
+				return nil, fmt.Errorf("tap network requires tap: %s", machine)
+			}
+			netdev = fmt.Sprintf("tap,id=%s,ifname=%s,script=no,downscript=no", id, network.Tap)
+		default:
+			return nil, fmt.Errorf("unknown network type: %s", network.Type)
+		}
+		device := fmt.Sprintf("virtio-net-pci,netdev=%s", id)
+		if network.MAC != "" {
+			device = fmt.Sprintf("%s,mac=%s", device, network.MAC)
+		}
+		args = append(args, "-netdev", netdev, "-device", device)
+	}
+	if len(m.Forwards) > 0 && !forwarded {
+		return nil, fmt.Errorf("port forwards require a user network: %s", machine)
+	}
+	if m.CloudInit != "" {
+		args = append(args, "-drive", fmt.Sprintf("file=%s,format=raw,if=virtio,media=cdrom,readonly=on", virtQEMUPath(v.resolve(m.CloudInit))))
+	}
+	return append(args, m.Arguments...), nil
+}
+
+// virtQEMUPath escapes commas (option separators) in qemu option values
+func virtQEMUPath(path string) string {
+	return strings.ReplaceAll(path, ",", ",,")
+}
+
+// definition reads the common machine description
+func (v virtContext) definition(machine string) (virtMachine, error) {
+	var m virtMachine
+	b, err := os.ReadFile(v.machineFile(machine))
+	if err != nil {
+		return m, err
+	}
+	if err := json.Unmarshal(b, &m); err != nil {
+		return m, fmt.Errorf("invalid machine definition: %s (%w)", machine, err)
+	}
+	return m, nil
+}
+
+// resolve makes paths in a machine definition relative to the machine directory
+func (v virtContext) resolve(path string) string {
+	if filepath.IsAbs(path) {
+		return path
+	}
+	return filepath.Join(v.dir, path)
+}
+
+// start logs via a generated screenrc (-Logfile requires screen 4.06+, macOS ships 4.00)
+func (virtScreenBackend) start(v virtContext, machine string, command []string) error {
+	var rc strings.Builder
+	if user := filepath.Join(os.Getenv("HOME"), ".screenrc"); PathExists(user) {
+		fmt.Fprintf(&rc, "source \"%s\"\n", user)
+	}
+	fmt.Fprintf(&rc, "logfile \"%s\"\nlogfile flush 1\n", v.logFile(machine))
+	config := filepath.Join(v.run, fmt.Sprintf("%s.screenrc", machine))
+	if err := os.WriteFile(config, []byte(rc.String()), 0o644); err != nil {
+		return err
+	}
+	args := []string{"-c", config, "-d", "-m", "-S", fmt.Sprintf(virtScreenName, machine), "-L"}
+	args = append(args, virtPidWrapper...)
+	args = append(args, v.pidFile(machine))
+	args = append(args, command...)
+	return exec.Command("screen", args...).Run()
+}
+
+func (virtScreenBackend) attach(_ virtContext, machine string) error {
+	return virtInteractive("screen", "-r", fmt.Sprintf(virtScreenName, machine))
+}
+
+func (virtTmuxBackend) start(v virtContext, machine string, command []string) error {
+	session := fmt.Sprintf(virtScreenName, machine)
+	args := []string{"new-session", "-d", "-s", session}
+	args = append(args, virtPidWrapper...)
+	args = append(args, v.pidFile(machine))
+	args = append(args, command...)
+	// chained so logging is setup (as a single tmux command) with the session
+	args = append(args, ";", "pipe-pane", "-o", "-t", session, fmt.Sprintf("cat >> '%s'", v.logFile(machine)))
+	return exec.Command("tmux", args...).Run()
+}
+
+func (virtTmuxBackend) attach(_ virtContext, machine string) error {
+	return virtInteractive("tmux", "attach-session", "-t", fmt.Sprintf(virtScreenName, machine))
+}
+
+// start daemonizes virt itself (in a new session) to supervise the machine
+func (virtNativeBackend) start(v virtContext, machine string, _ []string) error {
+	exe, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	log, err := os.OpenFile(v.logFile(machine), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+	defer log.Close()
+	cmd := exec.Command(exe, virtSupervise, machine)
+	cmd.Stdout = log
+	cmd.Stderr = log
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setsid: true}
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	return cmd.Process.Release()
+}
+
+func (virtNativeBackend) attach(v virtContext, machine string) error {
+	return virtInteractive("tail", "-f", v.logFile(machine))
+}
+
+func virtInteractive(exe string, args ...string) error {
+	cmd := exec.Command(exe, args...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	return cmd.Run()
+}
+
+// backend gets the machine backend settings (machine settings override global settings)
+func (v virtContext) backend(machine string) (virtBackend, virtBackendSettings, error) {
+	settings := v.settings.virtBackendSettings
+	if override, ok := v.settings.Machines[machine]; ok {
+		if override.Backend != "" {
+			settings.Backend = override.Backend
+		}
+		if override.Restart != "" {
+			settings.Restart = override.Restart
+		}
+		if override.RestartLimit > 0 {
+			settings.RestartLimit = override.RestartLimit
+		}
+	}
+	if settings.RestartLimit <= 0 {
+		settings.RestartLimit = virtRestartLimit
+	}
+	switch settings.Restart {
+	case "", virtRestartNever, virtRestartFailed, virtRestartAlways:
+	default:
+		return nil, settings, fmt.Errorf("unknown restart policy: %s", settings.Restart)
+	}
+	switch settings.Backend {
+	case "", virtScreen:
+		return virtScreenBackend{}, settings, nil
+	case virtTmux:
+		return virtTmuxBackend{}, settings, nil
+	case virtNative:
+		return virtNativeBackend{}, settings, nil
+	}
+	return nil, settings, fmt.Errorf("unknown backend: %s", settings.Backend)
+}
+
+// command gets the machine invocation from the machine engine
+func (v virtContext) command(machine string) ([]string, error) {
+	name := v.engine(machine)
+	var engine virtEngine
+	executable := v.settings.Engines[name]
+	switch name {
+	case "", virtVFU:
+		engine = virtVFUEngine{}
+		if executable == "" {
+			executable = v.settings.Executable
+		}
+		if executable == "" {
+			executable = virtVFU
+		}
+	case virtQEMU:
+		engine = virtQEMUEngine{}
+		if executable == "" {
+			arch := "x86_64"
+			if runtime.GOARCH == "arm64" {
+				arch = "aarch64"
+			}
+			executable = fmt.Sprintf("qemu-system-%s", arch)
+		}
+	default:
+		return nil, fmt.Errorf("unknown engine: %s", name)
+	}
+	return engine.command(v, machine, executable)
+}
+
+// engine gets the machine engine (machine settings, then the definition, then global settings)
+func (v virtContext) engine(machine string) string {
+	if override := v.settings.Machines[machine].Engine; override != "" {
+		return override
+	}
+	var definition struct {
+		Engine string
+	}
+	if b, err := os.ReadFile(v.machineFile(machine)); err == nil {
+		if json.Unmarshal(b, &definition) == nil && definition.Engine != "" {
+			return definition.Engine
+		}
+	}
+	return v.settings.Engine
+}
+
+// virtQuote quotes arguments for display as a shell command
+func virtQuote(args []string) string {
+	var quoted []string
+	for _, arg := range args {
+		if arg == "" || strings.ContainsAny(arg, " \t\n'\"$`\\|&;<>()*?[]{}~#!") {
+			arg = fmt.Sprintf("'%s'", strings.ReplaceAll(arg, "'", `'\''`))
+		}
+		quoted = append(quoted, arg)
+	}
+	return strings.Join(quoted, " ")
+}
+
+func (v virtContext) stopFile(machine string) string {
+	return filepath.Join(v.run, fmt.Sprintf("%s.stop", machine))
+}
+
+// supervise runs the machine (as a child) restarting it per the restart policy
+func (v virtContext) supervise(machine string) error {
+	_, settings, err := v.backend(machine)
+	if err != nil {
+		return err
+	}
+	command, err := v.command(machine)
+	if err != nil {
+		return err
+	}
+	for attempt := 0; ; attempt++ {
+		cmd := exec.Command(command[0], command[1:]...)
+		cmd.Stdout = os.Stdout
+		cmd.Stderr = os.Stderr
+		if err := cmd.Start(); err != nil {
+			return err
+		}
+		pid := cmd.Process.Pid
+		if err := os.WriteFile(v.pidFile(machine), []byte(fmt.Sprintf("%d\n%s\n", pid, virtIdentity(pid))), 0o644); err != nil {
+			return err
+		}
+		err := cmd.Wait()
+		if PathExists(v.stopFile(machine)) {
+			return os.Remove(v.stopFile(machine))
+		}
+		restart := settings.Restart == virtRestartAlways || (settings.Restart == virtRestartFailed && err != nil)
+		if !restart || attempt >= settings.RestartLimit {
+			os.Remove(v.pidFile(machine))
+			return err
+		}
+		fmt.Printf("[virt] restarting %s (%d/%d): %v\n", machine, attempt+1, settings.RestartLimit, err)
+		time.Sleep(time.Duration(attempt+1) * time.Second)
+	}
+}
+
+func (v virtContext) pidFile(machine string) string {
+	return filepath.Join(v.run, fmt.Sprintf("%s.pid", machine))
+}
+
+func (v virtContext) logFile(machine string) string {
+	return filepath.Join(v.run, fmt.Sprintf("%s.log", machine))
+}
+
+func (v virtContext) machineFile(machine string) string {
+	return filepath.Join(v.dir, fmt.Sprintf("%s%s", machine, virtJSON))
+}
+
+// pid gets the machine process id (from the pidfile) if it is running
+func (v virtContext) pid(machine string) (int, bool) {
+	pid, _, ok := v.process(machine)
+	return pid, ok
+}
+
+// process reads the pidfile (pid and start time), a pidfile for an exited (or reused) pid is removed
+func (v virtContext) process(machine string) (int, string, bool) {
+	path := v.pidFile(machine)
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return 0, "", false
+	}
+	text, identity, _ := strings.Cut(strings.TrimSpace(string(b)), "\n")
+	identity = strings.TrimSpace(identity)
+	pid, err := strconv.Atoi(strings.TrimSpace(text))
+	if err != nil || pid <= 0 {
+		return 0, "", false
+	}
+	if virtRunning(pid, identity) {
+		return pid, identity, true
+	}
+	// only removed when unchanged (the supervisor rewrites it on restart)
+	if current, err := os.ReadFile(path); err == nil && string(current) == string(b) {
+		os.Remove(path)
+	}
+	return pid, identity, false
+}
+
+func virtAlive(pid int) bool {
+	err := syscall.Kill(pid, 0)
+	return err == nil || errors.Is(err, syscall.EPERM)
+}
+
+// virtIdentity gets the process start time (empty when unknown)
+func virtIdentity(pid int) string {
+	out, err := exec.Command("ps", "-o", "lstart=", "-p", strconv.Itoa(pid)).Output()
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(out))
+}
+
+// virtRunning checks the pid is alive and is still the recorded process (pidfiles without a start time only check the pid)
+func virtRunning(pid int, identity string) bool {
+	if !virtAlive(pid) {
+		return false
+	}
+	return identity == "" || virtIdentity(pid) == identity
+}
+
+func (v virtContext) machine(name string) error {
+	if name == "" {
+		return errors.New("command requires machine")
+	}
+	if !slices.Contains(v.machines, name) {
+		return fmt.Errorf("unknown machine: %s", name)
+	}
+	return nil
+}
+
+func (v virtContext) start(machine string) error {
+	if _, ok := v.pid(machine); ok {
+		return fmt.Errorf("machine already running: %s", machine)
+	}
+	if err := os.MkdirAll(v.run, 0o755); err != nil {
+		return err
+	}
+	backend, _, err := v.backend(machine)
+	if err != nil {
+		return err
+	}
+	if v.engine(machine) == virtQEMU {
+		m, err := v.definitionOf(machine)
+		if err != nil {
+			return err
+		}
+		if errs := v.check(m, make(map[string]string), machine); len(errs) > 0 {
+			var reasons []string
+			for _, err := range errs {
+				reasons = append(reasons, err.Error())
+			}
+			return fmt.Errorf("invalid machine: %s (%s)", machine, strings.Join(reasons, "; "))
+		}
+	}
+	command, err := v.command(machine)
+	if err != nil {
+		return err
+	}
+	os.Remove(v.pidFile(machine))
+	os.Remove(v.stopFile(machine))
+	return backend.start(v, machine, command)
+}
+
+// stop asks the machine to stop (SIGTERM) and forces it (SIGKILL) after the timeout
+func (v virtContext) stop(machine string, timeout time.Duration) error {
+	pid, identity, ok := v.process(machine)
+	if !ok {
+		return fmt.Errorf("machine not running: %s", machine)
+	}
+	wait := func(d time.Duration) bool {
+		deadline := time.Now().Add(d)
+		for time.Now().Before(deadline) {
+			if !virtRunning(pid, identity) {
+				return true
+			}
+			time.Sleep(250 * time.Millisecond)
+		}
+		return !virtRunning(pid, identity)
+	}
+	if err := os.WriteFile(v.stopFile(machine), []byte{}, 0o644); err != nil {
+		return err
+	}
+	if err := syscall.Kill(pid, syscall.SIGTERM); err != nil {
+		return err
+	}
+	if !wait(timeout) {
+		fmt.Printf("forcing stop: %s\n", machine)
+		if err := syscall.Kill(pid, syscall.SIGKILL); err != nil {
+			return err
+		}
+		if !wait(5 * time.Second) {
+			return fmt.Errorf("unable to stop machine: %s (%d)", machine, pid)
+		}
+	}
+	os.Remove(v.stopFile(machine))
+	os.Remove(v.pidFile(machine))
+	return nil
+}
+
+func (v virtContext) attach(machine string) error {
+	if _, ok := v.pid(machine); !ok {
+		return fmt.Errorf("machine not running: %s", machine)
+	}
+	backend, _, err := v.backend(machine)
+	if err != nil {
+		return err
+	}
+	return backend.attach(v, machine)
+}
+
+// plan reads the machine orchestration fields from its definition (other fields are ignored)
+func (v virtContext) plan(machine string) (virtPlan, error) {
+	var p virtPlan
+	b, err := os.ReadFile(v.machineFile(machine))
+	if err != nil {
+		return p, err
+	}
+	if err := json.Unmarshal(b, &p); err != nil {
+		return p, fmt.Errorf("invalid machine definition: %s (%w)", machine, err)
+	}
+	return p, nil
+}
+
+// order resolves the machines to act on for a group (autostart machines when no group) in dependency order,
+// dependencies outside of the group are included when requested
+func (v virtContext) order(group string, dependencies bool) ([]string, map[string]virtPlan, error) {
+	plans := make(map[string]virtPlan)
+	for _, machine := range v.machines {
+		p, err := v.plan(machine)
+		if err != nil {
+			return nil, nil, err
+		}
+		plans[machine] = p
+	}
+	selected := make(map[string]bool)
+	for _, machine := range v.machines {
+		p := plans[machine]
+		if (group == "" && p.Autostart) || (group != "" && slices.Contains(p.Groups, group)) {
+			selected[machine] = true
+		}
+	}
+	if len(selected) == 0 {
+		if group == "" {
+			return nil, nil, errors.New("no autostart machines")
+		}
+		return nil, nil, fmt.Errorf("no machines in group: %s", group)
+	}
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+	state := make(map[string]int)
+	var ordered []string
+	var visit func(string, []string) error
+	visit = func(machine string, path []string) error {
+		switch state[machine] {
+		case visited:
+			return nil
+		case visiting:
+			return fmt.Errorf("dependency cycle: %s", strings.Join(append(path, machine), " -> "))
+		}
+		state[machine] = visiting
+		for _, dep := range plans[machine].Depends {
+			if _, ok := plans[dep]; !ok {
+				return fmt.Errorf("unknown dependency for %s: %s", machine, dep)
+			}
+			if err := visit(dep, append(path, machine)); err != nil {
+				return err
+			}
+		}
+		state[machine] = visited
+		if selected[machine] || dependencies {
+			ordered = append(ordered, machine)
+		}
+		return nil
+	}
+	for _, machine := range v.machines {
+		if selected[machine] {
+			if err := visit(machine, nil); err != nil {
+				return nil, nil, err
+			}
+		}
+	}
+	return ordered, plans, nil
+}
+
+// ready waits for the machine readiness probe (tcp address and/or command) to pass
+func (v virtContext) ready(machine string, probe *virtProbe) error {
+	if probe == nil || (probe.Address == "" && probe.Command == "") {
+		return nil
+	}
+	timeout := virtReadyTimeout
+	if probe.Timeout != "" {
+		d, err := time.ParseDuration(probe.Timeout)
+		if err != nil {
+			return err
+		}
+		timeout = d
+	}
+	check := func() error {
+		if probe.Address != "" {
+			conn, err := net.DialTimeout("tcp", probe.Address, time.Second)
+			if err != nil {
+				return err
+			}
+			conn.Close()
+		}
+		if probe.Command != "" {
+			if err := exec.Command("sh", "-c", probe.Command).Run(); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	// backends write the pidfile asynchronously, a missing pid is only an exit once it has been seen
+	begin := time.Now()
+	deadline := begin.Add(timeout)
+	seen := false
+	for {
+		err := check()
+		if err == nil {
+			return nil
+		}
+		_, running := v.pid(machine)
+		switch {
+		case running:
+			seen = true
+		case seen:
+			return errors.New("machine exited before ready")
+		case time.Since(begin) > min(virtStartGrace, timeout):
+			return errors.New("machine did not start")
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("not ready after %s: %w", timeout, err)
+		}
+		time.Sleep(time.Second)
+	}
+}
+
+// startGroup starts machines in dependency order, waiting for each to be ready before dependents start
+func (v virtContext) startGroup(group string) error {
+	ordered, plans, err := v.order(group, true)
+	if err != nil {
+		return err
+	}
+	failed := make(map[string]bool)
+	var failures []string
+	var results [][]string
+	for _, machine := range ordered {
+		started := time.Now()
+		result := "started"
+		err := func() error {
+			for _, dep := range plans[machine].Depends {
+				if failed[dep] {
+					result = "skipped"
+					return fmt.Errorf("dependency failed: %s", dep)
+				}
+			}
+			if _, ok := v.pid(machine); ok {
+				result = "running"
+			} else if err := v.start(machine); err != nil {
+				return err
+			}
+			return v.ready(machine, plans[machine].Ready)
+		}()
+		if err != nil {
+			failed[machine] = true
+			failures = append(failures, machine)
+			if result != "skipped" {
+				result = "failed"
+			}
+			result = fmt.Sprintf("%s (%v)", result, err)
+		}
+		results = append(results, []string{machine, result, time.Since(started).Round(time.Millisecond).String()})
+	}
+	virtTable([]string{"vm", "result", "time"}, results)
+	if len(failures) > 0 {
+		return fmt.Errorf("machines failed: %s", strings.Join(failures, ", "))
+	}
+	return nil
+}
+
+// stopGroup stops machines in reverse dependency order (dependencies outside of the group are left running)
+func (v virtContext) stopGroup(group string, timeout time.Duration) error {
+	ordered, _, err := v.order(group, false)
+	if err != nil {
+		return err
+	}
+	slices.Reverse(ordered)
+	var failures []string
+	var results [][]string
+	for _, machine := range ordered {
+		started := time.Now()
+		result := "stopped"
+		if _, ok := v.pid(machine); !ok {
+			result = "not running"
+		} else if err := v.stop(machine, timeout); err != nil {
+			failures = append(failures, machine)
+			result = fmt.Sprintf("failed (%v)", err)
+		}
+		results = append(results, []string{machine, result, time.Since(started).Round(time.Millisecond).String()})
+	}
+	virtTable([]string{"vm", "result", "time"}, results)
+	if len(failures) > 0 {
+		return fmt.Errorf("machines failed: %s", strings.Join(failures, ", "))
+	}
+	return nil
+}
+
+// virtProc reads process cpu ticks, uptime (seconds) and rss (bytes) from /proc
+func virtProc(pid int) (ticks, uptime, rss int64, err error) {
+	b, err := os.ReadFile(fmt.Sprintf("/proc/%d/stat", pid))
+	if err != nil {
+		return 0, 0, 0, err
+	}
+	// the command name can contain spaces, fields start after it
+	idx := strings.LastIndexByte(string(b), ')')
+	if idx < 0 {
+		return 0, 0, 0, errors.New("invalid stat")
+	}
+	fields := strings.Fields(string(b)[idx+1:])
+	if len(fields) < 22 {
+		return 0, 0, 0, errors.New("invalid stat")
+	}
+	parse := func(field int) int64 {
+		value, _ := strconv.ParseInt(fields[field-3], 10, 64)
+		return value
+	}
+	ticks = parse(14) + parse(15)
+	up, err := os.ReadFile("/proc/uptime")
+	if err != nil {
+		return 0, 0, 0, err
+	}
+	system, err := strconv.ParseFloat(strings.Fields(string(up))[0], 64)
+	if err != nil {
+		return 0, 0, 0, err
+	}
+	uptime = int64(system) - parse(22)/virtTicks
+	status, err := os.ReadFile(fmt.Sprintf("/proc/%d/status", pid))
+	if err != nil {
+		return 0, 0, 0, err
+	}
+	for _, line := range strings.Split(string(status), "\n") {
+		if value, ok := strings.CutPrefix(line, "VmRSS:"); ok {
+			kb, _ := strconv.ParseInt(strings.TrimSpace(strings.TrimSuffix(strings.TrimSpace(value), "kB")), 10, 64)
+			rss = kb * 1024
+		}
+	}
+	return ticks, uptime, rss, nil
+}
+
+// status gets the status of all machines, cpu usage is since the previous sample (or process start)
+func (v virtContext) status(samples map[string]virtSample) []virtStatus {
+	var result []virtStatus
+	for _, machine := range v.machines {
+		s := virtStatus{Name: machine, State: "stopped", Engine: v.engine(machine)}
+		if s.Engine == "" {
+			s.Engine = virtVFU
+		}
+		if _, settings, err := v.backend(machine); err == nil {
+			s.Backend = settings.Backend
+			if s.Backend == "" {
+				s.Backend = virtScreen
+			}
+		}
+		if s.Engine == virtQEMU {
+			if m, err := v.definitionOf(machine); err == nil {
+				s.CPUs = m.CPUs
+				s.Memory = m.Memory
+			}
+		}
+		if pid, ok := v.pid(machine); ok {
+			s.State = "running"
+			s.PID = pid
+			if ticks, uptime, rss, err := virtProc(pid); err == nil {
+				now := time.Now()
+				s.Uptime = uptime
+				s.RSS = rss
+				if prev, ok := samples[machine]; ok && now.After(prev.at) {
+					s.CPU = float64(ticks-prev.ticks) / virtTicks / now.Sub(prev.at).Seconds() * 100
+				} else if uptime > 0 {
+					s.CPU = float64(ticks) / virtTicks / float64(uptime) * 100
+				}
+				s.CPU = math.Round(s.CPU*10) / 10
+				samples[machine] = virtSample{ticks: ticks, at: now}
+			}
+		}
+		result = append(result, s)
+	}
+	return result
+}
+
+// printStatus displays machine statuses as a table or json
+func (v virtContext) printStatus(statuses []virtStatus, asJSON bool) error {
+	if asJSON {
+		b, err := json.MarshalIndent(statuses, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(b))
+		return nil
+	}
+	var rows [][]string
+	for _, s := range statuses {
+		row := []string{s.Name, s.State, "", "", "", "", "", s.Memory}
+		if s.PID > 0 {
+			row[2] = strconv.Itoa(s.PID)
+			row[3] = (time.Duration(s.Uptime) * time.Second).String()
+			row[4] = fmt.Sprintf("%.1f%%", s.CPU)
+			row[5] = fmt.Sprintf("%.1fM", float64(s.RSS)/1024/1024)
+		}
+		if s.CPUs > 0 {
+			row[6] = strconv.Itoa(s.CPUs)
+		}
+		rows = append(rows, row)
+	}
+	virtTable([]string{"vm", "status", "pid", "uptime", "cpu", "rss", "cpus", "memory"}, rows)
+	return nil
+}
+
+// watch refreshes the status until interrupted
+func (v virtContext) watch(interval time.Duration, asJSON bool) error {
+	samples := make(map[string]virtSample)
+	for {
+		statuses := v.status(samples)
+		if asJSON {
+			b, err := json.Marshal(statuses)
+			if err != nil {
+				return err
+			}
+			fmt.Println(string(b))
+		} else {
+			fmt.Print("\033[H\033[2J")
+			fmt.Printf("%s (every %s)\n\n", time.Now().Format(time.TimeOnly), interval)
+			if err := v.printStatus(statuses, false); err != nil {
+				return err
+			}
+		}
+		time.Sleep(interval)
+	}
+}
+
+// virtTable prints rows with columns sized to their content
+func virtTable(headers []string, rows [][]string) {
+	widths := make([]int, len(headers))
+	for _, row := range append([][]string{headers}, rows...) {
+		for idx, col := range row {
+			widths[idx] = max(widths[idx], len(col))
+		}
+	}
+	line := func(row []string) {
+		var cols []string
+		for idx, col := range row {
+			if idx == len(row)-1 {
+				cols = append(cols, col)
+				continue
+			}
+			cols = append(cols, fmt.Sprintf("%-*s", widths[idx], col))
+		}
+		fmt.Println(strings.TrimRight(strings.Join(cols, " "), " "))
+	}
+	line(headers)
+	total := len(widths) - 1
+	for _, w := range widths {
+		total += w
+	}
+	fmt.Println(strings.Repeat("-", total))
+	for _, row := range rows {
+		line(row)
+	}
+}
+
+// snapshotDir is where a snapshot of the disks in a directory (and the snapshot metadata) is kept
+func (v virtContext) snapshotDir(dir, machine, label string) string {
+	return filepath.Join(dir, virtSnapshots, machine, label)
+}
+
+// snapshots reads the machine snapshots (oldest first) from beside its disks, only qemu machines have snapshots
+func (v virtContext) snapshots(machine string) ([]virtSnapshot, error) {
+	if v.engine(machine) != virtQEMU {
+		return nil, nil
+	}
+	m, err := v.definitionOf(machine)
+	if err != nil {
+		return nil, err
+	}
+	var roots []string
+	for _, disk := range m.Disks {
+		root := filepath.Join(filepath.Dir(v.resolve(disk.Path)), virtSnapshots, machine)
+		if !slices.Contains(roots, root) {
+			roots = append(roots, root)
+		}
+	}
+	seen := make(map[string]bool)
+	var result []virtSnapshot
+	for _, root := range roots {
+		entries, err := os.ReadDir(root)
+		if err != nil {
+			if errors.Is(err, os.ErrNotExist) {
+				continue
+			}
+			return nil, err
+		}
+		for _, entry := range entries {
+			if !entry.IsDir() || seen[entry.Name()] {
+				continue
+			}
+			b, err := os.ReadFile(filepath.Join(root, entry.Name(), virtSnapshotMeta))
+			if err != nil {
+				if errors.Is(err, os.ErrNotExist) {
+					continue
+				}
+				return nil, err
+			}
+			var s virtSnapshot
+			if err := json.Unmarshal(b, &s); err != nil {
+				return nil, fmt.Errorf("invalid snapshot: %s (%w)", entry.Name(), err)
+			}
+			seen[entry.Name()] = true
+			result = append(result, s)
+		}
+	}
+	slices.SortFunc(result, func(a, b virtSnapshot) int {
+		return a.Created.Compare(b.Created)
+	})
+	return result, nil
+}
+
+// stopped requires a machine to not be running (for disk operations)
+func (v virtContext) stopped(machine string) error {
+	if _, ok := v.pid(machine); ok {
+		return fmt.Errorf("machine is running: %s", machine)
+	}
+	return nil
+}
+
+// snapshot copies the writable machine disks (read-only disks can not change), the metadata is written next to each copy
+func (v virtContext) snapshot(machine, label string) error {
+	if label == "" || label != filepath.Base(label) || strings.HasPrefix(label, ".") {
+		return fmt.Errorf("invalid snapshot label: %s", label)
+	}
+	if err := v.stopped(machine); err != nil {
+		return err
+	}
+	m, err := v.definitionOf(machine)
+	if err != nil {
+		return err
+	}
+	existing, err := v.snapshots(machine)
+	if err != nil {
+		return err
+	}
+	if slices.ContainsFunc(existing, func(s virtSnapshot) bool { return s.Label == label }) {
+		return fmt.Errorf("snapshot already exists: %s", label)
+	}
+	s := virtSnapshot{Label: label, Machine: machine, Created: time.Now()}
+	var created []string
+	cleanup := func() {
+		for _, dir := range created {
+			os.RemoveAll(dir)
+		}
+	}
+	for _, disk := range m.Disks {
+		if disk.ReadOnly {
+			continue
+		}
+		path := v.resolve(disk.Path)
+		info, err := os.Stat(path)
+		if err != nil {
+			cleanup()
+			return err
+		}
+		dir := v.snapshotDir(filepath.Dir(path), machine, label)
+		if !slices.Contains(created, dir) {
+			if PathExists(dir) {
+				cleanup()
+				return fmt.Errorf("snapshot directory already exists: %s", dir)
+			}
+			if err := os.MkdirAll(dir, 0o755); err != nil {
+				cleanup()
+				return err
+			}
+			created = append(created, dir)
+		}
+		target := filepath.Join(dir, filepath.Base(path))
+		fmt.Printf("copying disk: %s -> %s\n", path, target)
+		if err := virtCopy(path, target); err != nil {
+			cleanup()
+			return err
+		}
+		s.Disks = append(s.Disks, virtSnapshotDisk{Path: path, Copy: target, Size: info.Size()})
+	}
+	if len(s.Disks) == 0 {
+		cleanup()
+		return fmt.Errorf("no writable disks to snapshot: %s", machine)
+	}
+	b, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		cleanup()
+		return err
+	}
+	for _, dir := range created {
+		if err := os.WriteFile(filepath.Join(dir, virtSnapshotMeta), append(b, '\n'), 0o644); err != nil {
+			cleanup()
+			return err
+		}
+	}
+	return nil
+}
+
+// rollback replaces the machine disks with a snapshot (the snapshot is kept)
+func (v virtContext) rollback(machine, label string, yes bool) error {
+	if err := v.stopped(machine); err != nil {
+		return err
+	}
+	snapshots, err := v.snapshots(machine)
+	if err != nil {
+		return err
+	}
+	idx := slices.IndexFunc(snapshots, func(s virtSnapshot) bool {
+		return s.Label == label
+	})
+	if idx < 0 {
+		return fmt.Errorf("unknown snapshot: %s", label)
+	}
+	s := snapshots[idx]
+	for _, disk := range s.Disks {
+		if !PathExists(disk.Copy) {
+			return fmt.Errorf("snapshot disk is missing: %s", disk.Copy)
+		}
+		fmt.Printf("restoring disk: %s -> %s\n", disk.Copy, disk.Path)
+	}
+	if !virtConfirm(yes, fmt.Sprintf("rollback %s to %s (%s)", machine, label, s.Created.Format(time.DateTime))) {
+		return nil
+	}
+	for _, disk := range s.Disks {
+		// copied beside the disk first so the disk is replaced atomically
+		tmp := fmt.Sprintf("%s.rollback", disk.Path)
+		os.Remove(tmp)
+		if err := virtCopy(disk.Copy, tmp); err != nil {
+			return err
+		}
+		if err := os.Rename(tmp, disk.Path); err != nil {
+			os.Remove(tmp)
+			return err
+		}
+	}
+	return nil
+}
+
+// removeSnapshot deletes the snapshot disks and metadata
+func (v virtContext) removeSnapshot(s virtSnapshot) error {
+	for _, disk := range s.Disks {
+		dir := filepath.Dir(disk.Copy)
+		if err := os.RemoveAll(dir); err != nil {
+			return err
+		}
+		// the machine snapshot directory is removed once empty
+		os.Remove(filepath.Dir(dir))
+	}
+	return nil
+}
+
+// pruneSnapshots removes snapshots beyond a count (newest are kept) or older than a duration
+func (v virtContext) pruneSnapshots(machine, policy string, yes bool) error {
+	snapshots, err := v.snapshots(machine)
+	if err != nil {
+		return err
+	}
+	keep := virtSnapshotKeep
+	if v.settings.SnapshotKeep > 0 {
+		keep = v.settings.SnapshotKeep
+	}
+	var older time.Duration
+	if policy != "" {
+		if count, err := strconv.Atoi(policy); err == nil && count >= 0 {
+			keep = count
+		} else if d, err := time.ParseDuration(policy); err == nil && d > 0 {
+			older = d
+		} else {
+			return fmt.Errorf("invalid prune policy (count or duration): %s", policy)
+		}
+	}
+	var remove []virtSnapshot
+	for idx, s := range snapshots {
+		if older > 0 {
+			if time.Since(s.Created) > older {
+				remove = append(remove, s)
+			}
+			continue
+		}
+		if idx < len(snapshots)-keep {
+			remove = append(remove, s)
+		}
+	}
+	if len(remove) == 0 {
+		fmt.Println("no snapshots to prune")
+		return nil
+	}
+	for _, s := range remove {
+		fmt.Printf("removing snapshot: %s (%s)\n", s.Label, s.Created.Format(time.DateTime))
+	}
+	if !virtConfirm(yes, fmt.Sprintf("prune %d snapshot(s) of %s", len(remove), machine)) {
+		return nil
+	}
+	for _, s := range remove {
+		if err := v.removeSnapshot(s); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// access reads the machine forwards and ssh settings from its definition (other fields are ignored)
+func (v virtContext) access(machine string) (virtAccess, error) {
+	var a virtAccess
+	b, err := os.ReadFile(v.machineFile(machine))
+	if err != nil {
+		return a, err
+	}
+	if err := json.Unmarshal(b, &a); err != nil {
+		return a, fmt.Errorf("invalid machine definition: %s (%w)", machine, err)
+	}
+	return a, nil
+}
+
+// address gets the host side of a forward
+func (f virtForward) address() string {
+	host := f.Address
+	if host == "" {
+		host = "127.0.0.1"
+	}
+	return net.JoinHostPort(host, strconv.Itoa(f.Host))
+}
+
+func (f virtForward) protocol() string {
+	if f.Protocol == "" {
+		return "tcp"
+	}
+	return f.Protocol
+}
+
+// checkForwards validates forwards, seen tracks host ports across machines
+func virtCheckForwards(a virtAccess, seen map[string]string, machine string) []error {
+	var errs []error
+	names := make(map[string]bool)
+	for idx, f := range a.Forwards {
+		if f.Name == "" {
+			errs = append(errs, fmt.Errorf("forward %d has no name", idx))
+		} else if names[f.Name] {
+			errs = append(errs, fmt.Errorf("duplicate forward: %s", f.Name))
+		}
+		names[f.Name] = true
+		switch f.protocol() {
+		case "tcp", "udp":
+		default:
+			errs = append(errs, fmt.Errorf("unknown forward protocol: %s", f.Protocol))
+		}
+		if f.Host <= 0 || f.Host > 65535 || f.Guest <= 0 || f.Guest > 65535 {
+			errs = append(errs, fmt.Errorf("invalid forward ports: %s (%d -> %d)", f.Name, f.Host, f.Guest))
+			continue
+		}
+		key := fmt.Sprintf("port %s/%d", f.protocol(), f.Host)
+		if other, ok := seen[key]; ok && other != machine {
+			errs = append(errs, fmt.Errorf("host port %s/%d is also used by: %s", f.protocol(), f.Host, other))
+			continue
+		}
+		seen[key] = machine
+	}
+	if a.SSH != nil && a.SSH.Host == "" {
+		forward := a.SSH.Forward
+		if forward == "" {
+			forward = virtSSHForward
+		}
+		if !names[forward] {
+			errs = append(errs, fmt.Errorf("unknown ssh forward: %s", forward))
+		}
+	}
+	return errs
+}
+
+// sshTarget gets how to reach the machine over ssh (a direct host or the ssh forward)
+func (v virtContext) sshTarget(machine string) (host string, port int, settings virtSSH, err error) {
+	a, err := v.access(machine)
+	if err != nil {
+		return "", 0, settings, err
+	}
+	if a.SSH != nil {
+		settings = *a.SSH
+	}
+	if settings.Host != "" {
+		port = settings.Port
+		if port == 0 {
+			port = 22
+		}
+		return settings.Host, port, settings, nil
+	}
+	forward := settings.Forward
+	if forward == "" {
+		forward = virtSSHForward
+	}
+	for _, f := range a.Forwards {
+		if f.Name == forward && f.protocol() == "tcp" {
+			host, _, err := net.SplitHostPort(f.address())
+			return host, f.Host, settings, err
+		}
+	}
+	return "", 0, settings, fmt.Errorf("machine has no ssh host or forward: %s", machine)
+}
+
+// ssh connects to the machine (any arguments are the remote command)
+func (v virtContext) ssh(machine string, command []string) error {
+	if _, ok := v.pid(machine); !ok {
+		return fmt.Errorf("machine not running: %s", machine)
+	}
+	host, port, settings, err := v.sshTarget(machine)
+	if err != nil {
+		return err
+	}
+	// forwards share the host address, the alias keeps host keys per machine
+	args := []string{"-p", strconv.Itoa(port), "-o", fmt.Sprintf("HostKeyAlias=virt-%s", machine)}
+	if settings.IdentityFile != "" {
+		args = append(args, "-i", settings.IdentityFile)
+	}
+	if settings.User != "" {
+		host = fmt.Sprintf("%s@%s", settings.User, host)
+	}
+	args = append(args, host)
+	return virtInteractive("ssh", append(args, command...)...)
+}
+
+// ports displays the machine forwards
+func (v virtContext) ports(machine string) error {
+	a, err := v.access(machine)
+	if err != nil {
+		return err
+	}
+	var rows [][]string
+	for _, f := range a.Forwards {
+		rows = append(rows, []string{f.Name, f.protocol(), f.address(), strconv.Itoa(f.Guest)})
+	}
+	virtTable([]string{"name", "protocol", "host", "guest"}, rows)
+	return nil
+}
+
+// sshConfig writes an ssh config (for Include) with a host entry per reachable machine
+func (v virtContext) sshConfig(home string) error {
+	path := v.settings.SSHConfig
+	if path == "" {
+		path = virtSSHConfig
+	}
+	path = filepath.Join(home, path)
+	var buf bytes.Buffer
+	buf.WriteString("# generated by virt, do not edit\n")
+	for _, machine := range v.machines {
+		host, port, settings, err := v.sshTarget(machine)
+		if err != nil {
+			continue
+		}
+		fmt.Fprintf(&buf, "\nHost %s\n  HostName %s\n  Port %d\n  HostKeyAlias virt-%s\n", machine, host, port, machine)
+		if settings.User != "" {
+			fmt.Fprintf(&buf, "  User %s\n", settings.User)
+		}
+		if settings.IdentityFile != "" {
+			fmt.Fprintf(&buf, "  IdentityFile %s\n", settings.IdentityFile)
+		}
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return err
+	}
+	if err := os.WriteFile(path, buf.Bytes(), 0o600); err != nil {
+		return err
+	}
+	fmt.Printf("written: %s (add 'Include %s' to ~/.ssh/config)\n", path, path)
+	return nil
+}
+
+// virtMAC generates a random (locally administered, qemu prefixed) MAC address
+func virtMAC() (string, error) {
+	b := make([]byte, 3)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("52:54:00:%02x:%02x:%02x", b[0], b[1], b[2]), nil
+}
+
+// virtMemory parses qemu memory sizes (default unit is MiB) into MiB
+func virtMemory(value string) (int64, error) {
+	s := strings.TrimSuffix(strings.ToUpper(strings.TrimSpace(value)), "B")
+	multiplier := int64(1)
+	if len(s) > 0 {
+		switch s[len(s)-1] {
+		case 'M':
+			s = s[:len(s)-1]
+		case 'G':
+			multiplier = 1024
+			s = s[:len(s)-1]
+		case 'T':
+			multiplier = 1024 * 1024
+			s = s[:len(s)-1]
+		}
+	}
+	size, err := strconv.ParseInt(s, 10, 64)
+	if err != nil || size <= 0 {
+		return 0, fmt.Errorf("invalid memory: %s", value)
+	}
+	return size * multiplier, nil
+}
+
+// virtHostMemory gets the total host memory in MiB (0 if unknown)
+func virtHostMemory() int64 {
+	b, err := os.ReadFile("/proc/meminfo")
+	if err != nil {
+		return 0
+	}
+	for _, line := range strings.Split(string(b), "\n") {
+		if value, ok := strings.CutPrefix(line, "MemTotal:"); ok {
+			kb, err := strconv.ParseInt(strings.TrimSpace(strings.TrimSuffix(strings.TrimSpace(value), "kB")), 10, 64)
+			if err == nil {
+				return kb / 1024
+			}
+		}
+	}
+	return 0
+}
+
+// parse strictly reads a machine definition (unknown fields are errors)
+func (v virtContext) parse(data []byte) (virtMachine, error) {
+	var m virtMachine
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	err := decoder.Decode(&m)
+	return m, err
+}
+
+// check validates a machine definition, seen tracks addresses and ports across machines
+func (v virtContext) check(m virtMachine, seen map[string]string, machine string) []error {
+	var errs []error
+	if m.CPUs < 0 {
+		errs = append(errs, fmt.Errorf("invalid cpus: %d", m.CPUs))
+	}
+	if m.Memory == "" {
+		errs = append(errs, errors.New("memory is required"))
+	} else {
+		size, err := virtMemory(m.Memory)
+		switch {
+		case err != nil:
+			errs = append(errs, err)
+		case size < 64:
+			errs = append(errs, fmt.Errorf("memory is too small: %s", m.Memory))
+		default:
+			if host := virtHostMemory(); host > 0 && size > host {
+				errs = append(errs, fmt.Errorf("memory exceeds host memory (%dM): %s", host, m.Memory))
+			}
+		}
+	}
+	if len(m.Disks) == 0 {
+		errs = append(errs, errors.New("no disks"))
+	}
+	for idx, disk := range m.Disks {
+		if disk.Path == "" {
+			errs = append(errs, fmt.Errorf("disk %d has no path", idx))
+			continue
+		}
+		switch disk.Format {
+		case "", "qcow2", "raw", "vmdk", "vdi", "vhdx":
+		default:
+			errs = append(errs, fmt.Errorf("unknown disk format: %s", disk.Format))
+		}
+		if !PathExists(v.resolve(disk.Path)) {
+			errs = append(errs, fmt.Errorf("disk does not exist: %s", v.resolve(disk.Path)))
+		}
+	}
+	if m.CloudInit != "" && !PathExists(v.resolve(m.CloudInit)) {
+		errs = append(errs, fmt.Errorf("cloud-init seed does not exist: %s", v.resolve(m.CloudInit)))
+	}
+	for idx, network := range m.Network {
+		switch network.Type {
+		case "", "user":
+		case "bridge":
+			if network.Bridge == "" {
+				errs = append(errs, fmt.Errorf("network %d requires bridge", idx))
+			}
+		case "tap":
+			if network.Tap == "" {
+				errs = append(errs, fmt.Errorf("network %d requires tap", idx))
+			}
+		default:
+			errs = append(errs, fmt.Errorf("unknown network type: %s", network.Type))
+		}
+		if network.MAC == "" {
+			continue
+		}
+		mac, err := net.ParseMAC(network.MAC)
+		if err != nil || len(mac) != 6 {
+			errs = append(errs, fmt.Errorf("invalid mac address: %s", network.MAC))
+			continue
+		}
+		key := fmt.Sprintf("mac %s", mac.String())
+		if other, ok := seen[key]; ok && other != machine {
+			errs = append(errs, fmt.Errorf("mac address %s is also used by: %s", mac.String(), other))
+			continue
+		}
+		seen[key] = machine
+	}
+	if len(m.Forwards) > 0 && !slices.ContainsFunc(m.Network, func(n virtNetwork) bool {
+		return n.Type == "" || n.Type == "user"
+	}) {
+		errs = append(errs, errors.New("port forwards require a user network"))
+	}
+	return append(errs, virtCheckForwards(m.virtAccess, seen, machine)...)
+}
+
+// validate checks machine definitions (vfu definitions are only checked to be json)
+func (v virtContext) validate(machines []string) error {
+	seen := make(map[string]string)
+	var invalid []string
+	for _, machine := range machines {
+		var errs []error
+		b, err := os.ReadFile(v.machineFile(machine))
+		if err != nil {
+			errs = append(errs, err)
+		} else {
+			switch engine := v.engine(machine); engine {
+			case virtQEMU:
+				m, err := v.parse(b)
+				if err != nil {
+					errs = append(errs, err)
+				} else {
+					errs = append(errs, v.check(m, seen, machine)...)
+				}
+			case "", virtVFU:
+				if a, err := v.access(machine); err != nil {
+					errs = append(errs, err)
+				} else {
+					errs = append(errs, virtCheckForwards(a, seen, machine)...)
+				}
+			default:
+				errs = append(errs, fmt.Errorf("unknown engine: %s", engine))
+			}
+		}
+		if len(errs) == 0 {
+			fmt.Printf("%s: ok\n", machine)
+			continue
+		}
+		invalid = append(invalid, machine)
+		for _, err := range errs {
+			fmt.Printf("%s: %v\n", machine, err)
+		}
+	}
+	if len(invalid) > 0 {
+		return fmt.Errorf("invalid machines: %s", strings.Join(invalid, ", "))
+	}
+	return nil
+}
+
+// newMachine checks a new machine name is usable
+func (v virtContext) newMachine(name string) error {
+	if name == "" || name != filepath.Base(name) || strings.HasPrefix(name, ".") {
+		return fmt.Errorf("invalid machine name: %s", name)
+	}
+	if slices.Contains(v.machines, name) || PathExists(v.machineFile(name)) {
+		return fmt.Errorf("machine already exists: %s", name)
+	}
+	return nil
+}
+
+// create writes a machine definition from a template (in the templates directory)
+func (v virtContext) create(name, from string) error {
+	if err := v.newMachine(name); err != nil {
+		return err
+	}
+	text := virtDefaultTemplate
+	if from != "" {
+		b, err := os.ReadFile(filepath.Join(v.templates, fmt.Sprintf("%s%s", from, virtJSON)))
+		if err != nil {
+			return err
+		}
+		text = string(b)
+	}
+	t, err := template.New("machine").Parse(text)
+	if err != nil {
+		return err
+	}
+	mac, err := virtMAC()
+	if err != nil {
+		return err
+	}
+	var buf bytes.Buffer
+	if err := t.Execute(&buf, struct {
+		Name string
+		MAC  string
+	}{name, mac}); err != nil {
+		return err
+	}
+	m, err := v.parse(buf.Bytes())
+	if err != nil {
+		return fmt.Errorf("invalid template: %w", err)
+	}
+	if err := os.WriteFile(v.machineFile(name), buf.Bytes(), 0o644); err != nil {
+		return err
+	}
+	fmt.Printf("created: %s\n", v.machineFile(name))
+	for _, disk := range m.Disks {
+		if path := v.resolve(disk.Path); !PathExists(path) {
+			fmt.Printf("disk needs to be created: %s\n", path)
+		}
+	}
+	return nil
+}
+
+// images gets the machine disk images that belong to it (writable and not used by other machines)
+func (v virtContext) images(machine string, m virtMachine) (owned, shared []string, err error) {
+	used := make(map[string]bool)
+	for _, other := range v.machines {
+		if other == machine || v.engine(other) != virtQEMU {
+			continue
+		}
+		b, err := os.ReadFile(v.machineFile(other))
+		if err != nil {
+			return nil, nil, err
+		}
+		o, err := v.parse(b)
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid machine definition: %s (%w)", other, err)
+		}
+		for _, disk := range o.Disks {
+			used[v.resolve(disk.Path)] = true
+		}
+	}
+	for _, disk := range m.Disks {
+		path := v.resolve(disk.Path)
+		if disk.ReadOnly || used[path] {
+			shared = append(shared, path)
+			continue
+		}
+		owned = append(owned, path)
+	}
+	return owned, shared, nil
+}
+
+// virtConfirm prompts for confirmation (unless yes)
+func virtConfirm(yes bool, prompt string) bool {
+	if yes {
+		return true
+	}
+	fmt.Printf("%s? (y/N) ", prompt)
+	line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil {
+		return false
+	}
+	return strings.ToLower(strings.TrimSpace(line)) == "y"
+}
+
+// virtCopy copies a file (reflinks when possible) without overwriting
+func virtCopy(src, dst string) error {
+	if PathExists(dst) {
+		return fmt.Errorf("file already exists: %s", dst)
+	}
+	var clone []string
+	switch runtime.GOOS {
+	case "linux":
+		clone = []string{"--reflink=auto", "--sparse=always"}
+	case "darwin":
+		// clonefile(2) on APFS
+		clone = []string{"-c"}
+	}
+	if clone != nil {
+		if err := exec.Command("cp", append(clone, src, dst)...).Run(); err == nil {
+			return nil
+		}
+		os.Remove(dst)
+	}
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.OpenFile(dst, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		os.Remove(dst)
+		return err
+	}
+	return out.Close()
+}
+
+// definitionOf reads a machine definition that virt manages (qemu engine)
+func (v virtContext) definitionOf(machine string) (virtMachine, error) {
+	if engine := v.engine(machine); engine != virtQEMU {
+		return virtMachine{}, fmt.Errorf("machine is not a qemu machine definition: %s", machine)
+	}
+	b, err := os.ReadFile(v.machineFile(machine))
+	if err != nil {
+		return virtMachine{}, err
+	}
+	return v.parse(b)
+}
+
+// clone copies a (stopped) machine, its owned disks are copied and shared disks are referenced
+func (v virtContext) clone(machine, name string, yes bool) error {
+	if err := v.newMachine(name); err != nil {
+		return err
+	}
+	if _, ok := v.pid(machine); ok {
+		return fmt.Errorf("machine is running: %s", machine)
+	}
+	m, err := v.definitionOf(machine)
+	if err != nil {
+		return err
+	}
+	owned, _, err := v.images(machine, m)
+	if err != nil {
+		return err
+	}
+	copies := make(map[string]string)
+	for idx, disk := range m.Disks {
+		path := v.resolve(disk.Path)
+		if !slices.Contains(owned, path) {
+			fmt.Printf("sharing disk: %s\n", path)
+			continue
+		}
+		base := filepath.Base(disk.Path)
+		if rest, ok := strings.CutPrefix(base, machine); ok {
+			base = fmt.Sprintf("%s%s", name, rest)
+		} else {
+			base = fmt.Sprintf("%s-%s", name, base)
+		}
+		target := filepath.Join(filepath.Dir(disk.Path), base)
+		if PathExists(v.resolve(target)) {
+			return fmt.Errorf("disk already exists: %s", v.resolve(target))
+		}
+		copies[path] = v.resolve(target)
+		m.Disks[idx].Path = target
+		fmt.Printf("copying disk: %s -> %s\n", path, v.resolve(target))
+	}
+	for idx := range m.Network {
+		if m.Network[idx].MAC == "" {
+			continue
+		}
+		mac, err := virtMAC()
+		if err != nil {
+			return err
+		}
+		m.Network[idx].MAC = mac
+	}
+	if m.CloudInit != "" {
+		fmt.Printf("sharing cloud-init seed (machine identity may need a new seed): %s\n", v.resolve(m.CloudInit))
+	}
+	if !virtConfirm(yes, fmt.Sprintf("clone %s to %s", machine, name)) {
+		return nil
+	}
+	var done []string
+	for src, dst := range copies {
+		if err := virtCopy(src, dst); err != nil {
+			for _, file := range done {
+				os.Remove(file)
+			}
+			return err
+		}
+		done = append(done, dst)
+	}
+	b, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(v.machineFile(name), append(b, '\n'), 0o644)
+}
+
+// remove deletes a (stopped) machine definition, runtime files and owned disks
+func (v virtContext) remove(machine string, yes bool) error {
+	if _, ok := v.pid(machine); ok {
+		return fmt.Errorf("machine is running: %s", machine)
+	}
+	var owned []string
+	if v.engine(machine) == virtQEMU {
+		m, err := v.definitionOf(machine)
+		if err != nil {
+			return err
+		}
+		var shared []string
+		owned, shared, err = v.images(machine, m)
+		if err != nil {
+			return err
+		}
+		for _, path := range shared {
+			fmt.Printf("keeping shared disk: %s\n", path)
+		}
+	} else {
+		fmt.Printf("disks are not managed for engine: %s\n", v.engine(machine))
+	}
+	snapshots, err := v.snapshots(machine)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("removing definition: %s\n", v.machineFile(machine))
+	for _, path := range owned {
+		fmt.Printf("removing disk: %s\n", path)
+	}
+	for _, s := range snapshots {
+		fmt.Printf("removing snapshot: %s\n", s.Label)
+	}
+	if !virtConfirm(yes, fmt.Sprintf("remove %s", machine)) {
+		return nil
+	}
+	for _, s := range snapshots {
+		if err := v.removeSnapshot(s); err != nil {
+			return err
+		}
+	}
+	for _, path := range owned {
+		if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	}
+	for _, path := range []string{v.pidFile(machine), v.logFile(machine), v.stopFile(machine), filepath.Join(v.run, fmt.Sprintf("%s.screenrc", machine))} {
+		os.Remove(path)
+	}
+	return os.Remove(v.machineFile(machine))
+}
+
+// VirtApp handles wrapping hypervisors (vfu, qemu) with virt helpers
 func VirtApp(a Args) error {
 	const (
-		jsonFile      = ".json"
-		screenName    = "vfu-virt-%s"
-		startCommand  = "start"
-		statusCommand = "status"
-		listCommand   = "list"
+		startCommand     = "start"
+		stopCommand      = "stop"
+		restartCommand   = "restart"
+		attachCommand    = "attach"
+		logCommand       = "log"
+		statusCommand    = "status"
+		showCommand      = "show"
+		listCommand      = "list"
+		createCommand    = "create"
+		validCommand     = "validate"
+		cloneCommand     = "clone"
+		removeCommand    = "remove"
+		startGroup       = "start-group"
+		stopGroup        = "stop-group"
+		watchCommand     = "watch"
+		snapshotCommand  = "snapshot"
+		snapshotsCommand = "snapshots"
+		rollbackCommand  = "rollback"
+		pruneCommand     = "snapshot-prune"
+		sshCommand       = "ssh"
+		portsCommand     = "ports"
+		sshConfigCommand = "ssh-config"
 	)
 
 	args := os.Args
-	var cmd string
-	var sub string
-	switch len(args) {
-	case 2:
-	case 3:
-		sub = args[2]
-	default:
+	if len(args) < 2 {
 		return errors.New("invalid argument passed")
 	}
-	cfg := Configuration[struct {
-		Directory  string
-		Executable string
-	}]{}
+	cmd := args[1]
+	var params []string
+	yes := false
+	asJSON := false
+	for idx, arg := range args[2:] {
+		if cmd == sshCommand && len(params) == 1 && arg != "--" {
+			// everything after the machine is the remote command
+			params = append(params, args[idx+2:]...)
+			break
+		}
+		if arg == "--" {
+			params = append(params, args[idx+3:]...)
+			break
+		}
+		if !strings.HasPrefix(arg, "-") {
+			params = append(params, arg)
+			continue
+		}
+		switch strings.TrimLeft(arg, "-") {
+		case "yes":
+			yes = true
+		case "json":
+			asJSON = true
+		default:
+			return fmt.Errorf("unknown flag: %s", arg)
+		}
+	}
+	arity := func(minimum, maximum int) error {
+		if len(params) < minimum || len(params) > maximum {
+			return errors.New("invalid argument passed")
+		}
+		return nil
+	}
+	var sub string
+	if len(params) > 0 {
+		sub = params[0]
+	}
+	cfg := Configuration[virtSettings]{}
 	if err := cfg.Load(a); err != nil {
 		return err
 	}
-	dir := filepath.Join(os.Getenv("HOME"), cfg.Settings.Directory)
-	files, err := os.ReadDir(dir)
+	home := os.Getenv("HOME")
+	runtimeDir := cfg.Settings.Runtime
+	if runtimeDir == "" {
+		runtimeDir = virtRuntime
+	}
+	stopTimeout := virtStopTimeout
+	if cfg.Settings.StopTimeout != "" {
+		d, err := time.ParseDuration(cfg.Settings.StopTimeout)
+		if err != nil {
+			return err
+		}
+		stopTimeout = d
+	}
+	v := virtContext{settings: cfg.Settings, dir: filepath.Join(home, cfg.Settings.Directory), run: filepath.Join(home, runtimeDir)}
+	v.templates = filepath.Join(v.dir, "templates")
+	if cfg.Settings.Templates != "" {
+		v.templates = filepath.Join(home, cfg.Settings.Templates)
+	}
+	files, err := os.ReadDir(v.dir)
 	if err != nil {
 		return err
 	}
-	var machines []string
 	for _, f := range files {
 		name := f.Name()
-		if m, ok := strings.CutSuffix(name, jsonFile); ok {
-			machines = append(machines, m)
+		if m, ok := strings.CutSuffix(name, virtJSON); ok {
+			v.machines = append(v.machines, m)
 		}
 	}
-	cmd = args[1]
 	switch cmd {
+	case listCommand, statusCommand, sshConfigCommand:
+		if err := arity(0, 0); err != nil {
+			return err
+		}
+	case createCommand, pruneCommand:
+		if err := arity(1, 2); err != nil {
+			return err
+		}
+	case cloneCommand, snapshotCommand, rollbackCommand:
+		if err := arity(2, 2); err != nil {
+			return err
+		}
+	case validCommand, sshCommand:
+	default:
+		if err := arity(0, 1); err != nil {
+			return err
+		}
+	}
+	switch cmd {
+	case createCommand:
+		var from string
+		if len(params) > 1 {
+			from = params[1]
+		}
+		return v.create(sub, from)
+	case validCommand:
+		machines := v.machines
+		if len(params) > 0 {
+			for _, machine := range params {
+				if err := v.machine(machine); err != nil {
+					return err
+				}
+			}
+			machines = params
+		}
+		return v.validate(machines)
+	case cloneCommand:
+		if err := v.machine(sub); err != nil {
+			return err
+		}
+		return v.clone(sub, params[1], yes)
+	case removeCommand:
+		if err := v.machine(sub); err != nil {
+			return err
+		}
+		return v.remove(sub, yes)
+	case sshConfigCommand:
+		return v.sshConfig(home)
+	case sshCommand, portsCommand:
+		if err := v.machine(sub); err != nil {
+			return err
+		}
+		if cmd == portsCommand {
+			return v.ports(sub)
+		}
+		return v.ssh(sub, params[1:])
+	case snapshotCommand, snapshotsCommand, rollbackCommand, pruneCommand:
+		if err := v.machine(sub); err != nil {
+			return err
+		}
+		// vfu definitions are passed to vfu as-is, their disks are not managed (or snapshotted)
+		if engine := v.engine(sub); engine != virtQEMU {
+			if engine == "" {
+				engine = virtVFU
+			}
+			return fmt.Errorf("snapshots are not supported for engine: %s (only %s machine disks are managed)", engine, virtQEMU)
+		}
+		switch cmd {
+		case snapshotCommand:
+			return v.snapshot(sub, params[1])
+		case rollbackCommand:
+			return v.rollback(sub, params[1], yes)
+		case pruneCommand:
+			var policy string
+			if len(params) > 1 {
+				policy = params[1]
+			}
+			return v.pruneSnapshots(sub, policy, yes)
+		}
+		snapshots, err := v.snapshots(sub)
+		if err != nil {
+			return err
+		}
+		var rows [][]string
+		for _, s := range snapshots {
+			var size int64
+			for _, disk := range s.Disks {
+				size += disk.Size
+			}
+			rows = append(rows, []string{s.Label, s.Created.Format(time.DateTime), strconv.Itoa(len(s.Disks)), fmt.Sprintf("%.1fM", float64(size)/1024/1024)})
+		}
+		virtTable([]string{"label", "created", "disks", "size"}, rows)
+		return nil
+	case startGroup:
+		return v.startGroup(sub)
+	case stopGroup:
+		return v.stopGroup(sub, stopTimeout)
 	case listCommand:
-		for _, item := range machines {
+		for _, item := range v.machines {
 			fmt.Println(item)
 		}
 		return nil
 	case CompletionKeyword:
 		data := struct {
-			Exe     string
-			List    string
-			Options string
-			Start   string
-		}{Start: startCommand, Exe: a.Name, List: fmt.Sprintf("%s %s", a.Name, listCommand), Options: strings.Join([]string{listCommand, statusCommand, startCommand}, " ")}
+			Exe      string
+			List     string
+			Options  string
+			Machines string
+		}{Exe: a.Name, List: fmt.Sprintf("%s %s", a.Name, listCommand), Options: strings.Join([]string{listCommand, statusCommand, startCommand, stopCommand, restartCommand, attachCommand, logCommand, showCommand, createCommand, validCommand, cloneCommand, removeCommand, startGroup, stopGroup, watchCommand, snapshotCommand, snapshotsCommand, rollbackCommand, pruneCommand, sshCommand, portsCommand, sshConfigCommand}, " "), Machines: strings.Join([]string{startCommand, stopCommand, restartCommand, attachCommand, logCommand, showCommand, validCommand, cloneCommand, removeCommand, snapshotCommand, snapshotsCommand, rollbackCommand, pruneCommand, sshCommand, portsCommand}, "|")}
 		const (
 			bashCompletion = `#!/usr/bin/env bash
 
@@ -75,7 +2093,7 @@ _{{ $.Exe }}() {
   else
     if [ "$COMP_CWORD" -eq 2 ]; then
       case "${COMP_WORDS[1]}" in
-        "{{ $.Start }}")
+        {{ $.Machines }})
           COMPREPLY=( $(compgen -W "$({{ $.List }})" -- "$cur") )
           ;;
       esac
@@ -99,7 +2117,7 @@ complete -F _{{ $.Exe }} -o bashdefault {{ $.Exe }}`
     ;;
     *)
       case $words[2] in
-        "{{ $.Start }}")
+        {{ $.Machines }})
           if [ "$len" -eq 3 ]; then
             compadd "$@" $({{ $.List }})
           fi
@@ -108,32 +2126,59 @@ complete -F _{{ $.Exe }} -o bashdefault {{ $.Exe }}`
   esac`
 		)
 		return CompletionType{Bash: bashCompletion, Zsh: zshCompletion, ZshCompDef: true}.Generate(data)
-	case startCommand:
-		if sub == "" {
-			return errors.New("start requires machine")
+	case virtSupervise:
+		if err := v.machine(sub); err != nil {
+			return err
+		}
+		return v.supervise(sub)
+	case startCommand, stopCommand, restartCommand, attachCommand, logCommand, showCommand:
+		if err := v.machine(sub); err != nil {
+			return err
 		}
-		if !slices.Contains(machines, sub) {
-			return fmt.Errorf("unknown machine: %s", sub)
+		switch cmd {
+		case startCommand:
+			return v.start(sub)
+		case stopCommand:
+			return v.stop(sub, stopTimeout)
+		case restartCommand:
+			if _, ok := v.pid(sub); ok {
+				if err := v.stop(sub, stopTimeout); err != nil {
+					return err
+				}
+			}
+			return v.start(sub)
+		case attachCommand:
+			return v.attach(sub)
+		case logCommand:
+			b, err := os.ReadFile(v.logFile(sub))
+			if err != nil {
+				return err
+			}
+			fmt.Print(string(b))
+			return nil
+		case showCommand:
+			command, err := v.command(sub)
+			if err != nil {
+				return err
+			}
+			fmt.Println(virtQuote(command))
+			return nil
 		}
-		return exec.Command("screen", "-d", "-m", "-S", fmt.Sprintf(screenName, sub), cfg.Settings.Executable, "--config", filepath.Join(dir, fmt.Sprintf("%s%s", sub, jsonFile))).Run()
 	case statusCommand:
-		printTable("vm", "status")
-		fmt.Println("------------------")
-		screens, _ := exec.Command("screen", "-list").CombinedOutput()
-		s := string(screens)
-		for _, machine := range machines {
-			state := "stopped"
-			screen := fmt.Sprintf(screenName, machine)
-			if strings.Contains(s, screen) {
-				state = "running"
-			}
-			printTable(machine, state)
+		return v.printStatus(v.status(make(map[string]virtSample)), asJSON)
+	case watchCommand:
+		interval := 2 * time.Second
+		if sub != "" {
+			d, err := time.ParseDuration(sub)
+			if err != nil {
+				return err
+			}
+			if d <= 0 {
+				return errors.New("watch interval must be positive")
+			}
+			interval = d
 		}
-		return nil
+		return v.watch(interval, asJSON)
 	}
 	return errors.New("invalid command")
 }
-
-func printTable(name, state string) {
-	fmt.Printf("%-10s %s\n", name, state)
-}